@@ -1,14 +1,75 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/lk16/heyluuk/internal"
+	"github.com/sirupsen/logrus"
 )
 
-const postgresHost = "db"
+const (
+	postgresHost = "db"
+
+	// shutdownTimeout is how long requests in flight get to finish, docker stops waiting after 10s
+	shutdownTimeout = 8 * time.Second
+)
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := internal.RunMigrate(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "verify-log" {
+		if err := internal.RunVerifyLog(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "normalize-links" {
+		if err := internal.RunNormalizeLinks(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Echo instance
 	server := internal.GetServer()
-	server.Logger.Fatal(server.Start(":8080"))
+
+	address := ":8080"
+	go func() {
+		logrus.WithField("address", address).Info("starting server")
+		if err := server.Start(address); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Fatal("server stopped")
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
+	received := <-quit
+
+	logrus.WithField("signal", received.String()).Info("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.WithError(err).Error("shutdown failed")
+		os.Exit(1)
+	}
+
+	logrus.Info("server stopped")
 }
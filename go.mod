@@ -1,9 +1,15 @@
 module github.com/lk16/heyluuk
 
-go 1.13
+go 1.16
 
 require (
 	github.com/jinzhu/gorm v1.9.12
 	github.com/labstack/echo/v4 v4.1.13
+	github.com/lib/pq v1.1.1
+	github.com/prometheus/client_golang v1.5.1
+	github.com/sirupsen/logrus v1.5.0
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/crypto v0.0.0-20191227163750-53104e6ec876
+	golang.org/x/net v0.0.0-20191209160850-c0dbc17a3553
+	golang.org/x/text v0.3.2
 )
@@ -0,0 +1,174 @@
+// Package assets serves static files under URLs containing a hash of their content,
+// so browsers can cache them until the file changes
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Prefix is the URL path static files are served under
+	Prefix = "/static/"
+
+	// hashLength is the number of hex digits of the content hash in file names
+	hashLength = 12
+
+	cacheForever    = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+)
+
+// Assets knows the content hashes of a tree of static files
+type Assets struct {
+	fsys   fs.FS
+	hashes map[string]string
+
+	// Live hashes files on every use instead of once, which is meant for files on disk that
+	// may be edited while serving, so they never end up cached under an outdated hash
+	Live bool
+}
+
+// hashFile returns the content hash of a file in fsys
+func hashFile(fsys fs.FS, name string) (string, error) {
+
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:hashLength], nil
+}
+
+// New hashes all files in fsys
+func New(fsys fs.FS) (*Assets, error) {
+
+	hashes := make(map[string]string)
+
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		hash, err := hashFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		hashes[name] = hash
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Assets{fsys: fsys, hashes: hashes}, nil
+}
+
+// hash returns the current content hash of a file
+func (a *Assets) hash(name string) (string, bool) {
+
+	if !a.Live {
+		hash, ok := a.hashes[name]
+		return hash, ok
+	}
+
+	hash, err := hashFile(a.fsys, name)
+	return hash, err == nil
+}
+
+// URL returns the URL of a static file with its content hash, like /static/style.0123456789ab.css.
+// Unknown files get their plain URL.
+func (a *Assets) URL(name string) string {
+
+	hash, ok := a.hash(name)
+	if !ok {
+		return Prefix + name
+	}
+
+	ext := path.Ext(name)
+	return Prefix + strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// isHash checks if s looks like a content hash
+func isHash(s string) bool {
+	if len(s) != hashLength {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// unhash splits a file name made by URL into the original name and the hash,
+// the hash is empty when name has none
+func unhash(name string) (string, string) {
+
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	// files without extension get the hash as extension
+	if isHash(strings.TrimPrefix(ext, ".")) {
+		return stem, ext[1:]
+	}
+
+	hashExt := path.Ext(stem)
+	if !isHash(strings.TrimPrefix(hashExt, ".")) {
+		return name, ""
+	}
+
+	return strings.TrimSuffix(stem, hashExt) + ext, hashExt[1:]
+}
+
+// Handler serves the static file in the * route parameter. Files requested with their current
+// hash are cached for a year, all others are revalidated on every use.
+func (a *Assets) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		name := strings.TrimPrefix(path.Clean("/"+c.Param("*")), "/")
+		hash := ""
+
+		if _, err := fs.Stat(a.fsys, name); err != nil {
+			name, hash = unhash(name)
+		}
+
+		file, err := a.fsys.Open(name)
+		if err != nil {
+			return echo.ErrNotFound
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			return echo.ErrNotFound
+		}
+
+		content, ok := file.(io.ReadSeeker)
+		if !ok {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				return err
+			}
+			content = bytes.NewReader(data)
+		}
+
+		header := c.Response().Header()
+		if current, ok := a.hash(name); ok && hash == current {
+			header.Set("Cache-Control", cacheForever)
+			header.Set("ETag", `"`+hash+`"`)
+		} else {
+			header.Set("Cache-Control", cacheRevalidate)
+		}
+
+		http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), content)
+		return nil
+	}
+}
@@ -0,0 +1,138 @@
+package assets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAssets(t *testing.T) *Assets {
+
+	assets, err := New(fstest.MapFS{
+		"style.css":                   {Data: []byte("body {}")},
+		"vendor/jquery/jquery.js":     {Data: []byte("jQuery")},
+		"vendor/font-awesome/LICENSE": {Data: []byte("MIT")},
+	})
+	assert.Nil(t, err)
+
+	return assets
+}
+
+// get requests name from the handler of assets
+func get(assets *Assets, name string) *httptest.ResponseRecorder {
+
+	e := echo.New()
+	e.GET(Prefix+"*", assets.Handler())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, name, nil))
+	return rec
+}
+
+func TestURL(t *testing.T) {
+
+	assets := testAssets(t)
+
+	// echo -n "body {}" | sha256sum | cut -c1-12
+	assert.Equal(t, "/static/style.62368a1a2925.css", assets.URL("style.css"))
+	assert.Regexp(t, `^/static/vendor/jquery/jquery\.[0-9a-f]{12}\.js$`, assets.URL("vendor/jquery/jquery.js"))
+	assert.Regexp(t, `^/static/vendor/font-awesome/LICENSE\.[0-9a-f]{12}$`, assets.URL("vendor/font-awesome/LICENSE"))
+	assert.Equal(t, "/static/missing.js", assets.URL("missing.js"))
+}
+
+func TestUnhash(t *testing.T) {
+
+	type testCase struct {
+		name         string
+		expectedName string
+		expectedHash string
+	}
+
+	testCases := []testCase{
+		{"style.0123456789ab.css", "style.css", "0123456789ab"},
+		{"css/all.min.0123456789ab.css", "css/all.min.css", "0123456789ab"},
+		{"LICENSE.0123456789ab", "LICENSE", "0123456789ab"},
+		{"style.css", "style.css", ""},
+		{"all.min.css", "all.min.css", ""},
+		{"style.0123456789xy.css", "style.0123456789xy.css", ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			name, hash := unhash(testCase.name)
+			assert.Equal(t, testCase.expectedName, name)
+			assert.Equal(t, testCase.expectedHash, hash)
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+
+	assets := testAssets(t)
+
+	t.Run("Hashed", func(t *testing.T) {
+		rec := get(assets, assets.URL("style.css"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "body {}", rec.Body.String())
+		assert.Equal(t, cacheForever, rec.Header().Get("Cache-Control"))
+		assert.Contains(t, rec.Header().Get("Content-Type"), "text/css")
+	})
+
+	t.Run("Plain", func(t *testing.T) {
+		rec := get(assets, "/static/vendor/jquery/jquery.js")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "jQuery", rec.Body.String())
+		assert.Equal(t, cacheRevalidate, rec.Header().Get("Cache-Control"))
+	})
+
+	t.Run("OldHash", func(t *testing.T) {
+		rec := get(assets, "/static/style.0123456789ab.css")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, cacheRevalidate, rec.Header().Get("Cache-Control"))
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+		e := echo.New()
+		e.GET(Prefix+"*", assets.Handler())
+
+		req := httptest.NewRequest(http.MethodGet, assets.URL("style.css"), nil)
+		req.Header.Set("If-None-Match", `"`+assets.hashes["style.css"]+`"`)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get(assets, "/static/missing.js").Code)
+		assert.Equal(t, http.StatusNotFound, get(assets, "/static/vendor").Code)
+		assert.Equal(t, http.StatusNotFound, get(assets, "/static/../web.go").Code)
+	})
+}
+
+func TestHandlerLive(t *testing.T) {
+
+	fsys := fstest.MapFS{"style.css": {Data: []byte("body {}")}}
+
+	assets, err := New(fsys)
+	assert.Nil(t, err)
+	assets.Live = true
+
+	oldURL := assets.URL("style.css")
+	assert.Equal(t, "public, max-age=31536000, immutable", get(assets, oldURL).Header().Get("Cache-Control"))
+
+	// the file is edited while serving, which is never cached under the old hash
+	fsys["style.css"] = &fstest.MapFile{Data: []byte("body { color: red; }")}
+
+	rec := get(assets, oldURL)
+	assert.Equal(t, "body { color: red; }", rec.Body.String())
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+
+	// and gets a URL of its own
+	newURL := assets.URL("style.css")
+	assert.NotEqual(t, oldURL, newURL)
+	assert.Equal(t, "public, max-age=31536000, immutable", get(assets, newURL).Header().Get("Cache-Control"))
+}
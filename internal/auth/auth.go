@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BearerToken returns the bearer token of the request, or an empty string
+func BearerToken(c echo.Context) string {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	return strings.TrimPrefix(header, "Bearer ")
+}
+
+// Matches compares token to expected in constant time, nothing matches an empty expected token
+func Matches(token, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// IsAdmin checks if the request carries the admin token as bearer token
+func IsAdmin(c echo.Context, adminToken string) bool {
+	return Matches(BearerToken(c), adminToken)
+}
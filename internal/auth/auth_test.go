@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// testContext returns a context for a request with an authorization header
+func testContext(authorization string) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		req.Header.Set(echo.HeaderAuthorization, authorization)
+	}
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestMatches(t *testing.T) {
+	assert.True(t, Matches("secret", "secret"))
+	assert.False(t, Matches("wrong", "secret"))
+	assert.False(t, Matches("", ""))
+}
+
+func TestIsAdmin(t *testing.T) {
+
+	c := testContext("Bearer secret")
+	assert.Equal(t, "secret", BearerToken(c))
+	assert.True(t, IsAdmin(c, "secret"))
+	assert.False(t, IsAdmin(c, "other"))
+	assert.False(t, IsAdmin(c, ""))
+
+	c = testContext("")
+	assert.Equal(t, "", BearerToken(c))
+	assert.False(t, IsAdmin(c, ""))
+}
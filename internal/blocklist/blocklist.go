@@ -0,0 +1,222 @@
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rules is a parsed blocklist file
+type rules struct {
+	// hosts are blocked only when matching exactly
+	hosts map[string]struct{}
+
+	// suffixes block a domain and all of its subdomains
+	suffixes []string
+
+	// regexes are matched against the full host
+	regexes []*regexp.Regexp
+}
+
+// parse reads a blocklist, one rule per line:
+//
+//	example.com      blocks exactly example.com
+//	*.example.com    blocks example.com and all of its subdomains
+//	/^spam[0-9]+\./  blocks every host matching the regular expression
+//
+// Empty lines and lines starting with # are ignored.
+func parse(r io.Reader) (*rules, error) {
+
+	parsed := &rules{hosts: make(map[string]struct{})}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case len(line) > 2 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/"):
+			regex, err := regexp.Compile(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNumber, err.Error())
+			}
+			parsed.regexes = append(parsed.regexes, regex)
+		case strings.HasPrefix(line, "*."):
+			parsed.suffixes = append(parsed.suffixes, normalizeHost(line[2:]))
+		default:
+			parsed.hosts[normalizeHost(line)] = struct{}{}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return parsed, nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// match returns the rule blocking host as written in the blocklist file, or an empty string
+func (r *rules) match(host string) string {
+
+	host = normalizeHost(host)
+
+	if _, ok := r.hosts[host]; ok {
+		return host
+	}
+
+	for _, suffix := range r.suffixes {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return "*." + suffix
+		}
+	}
+
+	for _, regex := range r.regexes {
+		if regex.MatchString(host) {
+			return "/" + regex.String() + "/"
+		}
+	}
+
+	return ""
+}
+
+// Blocklist holds the rules of a blocklist file and reloads them when the file changes
+type Blocklist struct {
+	path string
+
+	mutex   sync.RWMutex
+	rules   *rules
+	modTime time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+}
+
+// New loads the blocklist file at path
+func New(path string) (*Blocklist, error) {
+
+	bl := &Blocklist{
+		path: path,
+		stop: make(chan struct{}),
+	}
+
+	if err := bl.Reload(); err != nil {
+		return nil, err
+	}
+
+	return bl, nil
+}
+
+// Reload parses the blocklist file again, on failure the previous rules stay active
+func (bl *Blocklist) Reload() error {
+
+	file, err := os.Open(bl.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parse(file)
+	if err != nil {
+		return fmt.Errorf("blocklist %s: %s", bl.path, err.Error())
+	}
+
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	bl.rules = parsed
+	bl.modTime = info.ModTime()
+	return nil
+}
+
+// changed checks if the modification time of the file differs from the one of the loaded rules
+func (bl *Blocklist) changed() bool {
+
+	info, err := os.Stat(bl.path)
+	if err != nil {
+		return false
+	}
+
+	bl.mutex.RLock()
+	defer bl.mutex.RUnlock()
+
+	return !info.ModTime().Equal(bl.modTime)
+}
+
+// Watch reloads the blocklist when the file changes or the process receives SIGHUP, until Close is called
+func (bl *Blocklist) Watch(interval time.Duration) {
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(interval)
+
+	bl.done.Add(1)
+	go func() {
+		defer bl.done.Done()
+		defer ticker.Stop()
+		defer signal.Stop(hangup)
+
+		for {
+			select {
+			case <-bl.stop:
+				return
+			case <-hangup:
+				bl.reloadAndLog()
+			case <-ticker.C:
+				if bl.changed() {
+					bl.reloadAndLog()
+				}
+			}
+		}
+	}()
+}
+
+func (bl *Blocklist) reloadAndLog() {
+	if err := bl.Reload(); err != nil {
+		logrus.WithField("file", bl.path).WithError(err).Error("reloading blocklist failed")
+		return
+	}
+	logrus.WithField("file", bl.path).Info("reloaded blocklist")
+}
+
+// Close stops watching the blocklist file
+func (bl *Blocklist) Close() error {
+	bl.stopOnce.Do(func() {
+		close(bl.stop)
+	})
+	bl.done.Wait()
+	return nil
+}
+
+// Match returns the rule blocking links to host, or an empty string when they are allowed
+func (bl *Blocklist) Match(host string) string {
+	bl.mutex.RLock()
+	defer bl.mutex.RUnlock()
+
+	return bl.rules.match(host)
+}
@@ -0,0 +1,148 @@
+package blocklist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRules = `
+# comments and empty lines are ignored
+
+exact.com
+*.suffix.org
+/^spam[0-9]+\./
+`
+
+func writeBlocklist(t *testing.T, dir string, content string) string {
+	path := filepath.Join(dir, "blocklist.txt")
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	assert.Nil(t, err)
+	return path
+}
+
+func TestParse(t *testing.T) {
+
+	t.Run("OK", func(t *testing.T) {
+		parsed, err := parse(strings.NewReader(testRules))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(parsed.hosts))
+		assert.Equal(t, []string{"suffix.org"}, parsed.suffixes)
+		assert.Equal(t, 1, len(parsed.regexes))
+	})
+
+	t.Run("InvalidRegex", func(t *testing.T) {
+		_, err := parse(strings.NewReader("foo.com\n/[/\n"))
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "line 2")
+	})
+}
+
+func TestRulesMatch(t *testing.T) {
+
+	parsed, err := parse(strings.NewReader(testRules))
+	assert.Nil(t, err)
+
+	type testCase struct {
+		host string
+		rule string
+	}
+
+	testCases := []testCase{
+		testCase{"exact.com", "exact.com"},
+		testCase{"EXACT.com.", "exact.com"},
+		testCase{"sub.exact.com", ""},
+		testCase{"notexact.com", ""},
+		testCase{"suffix.org", "*.suffix.org"},
+		testCase{"a.b.suffix.org", "*.suffix.org"},
+		testCase{"notsuffix.org", ""},
+		testCase{"spam123.net", `/^spam[0-9]+\./`},
+		testCase{"spam.net", ""},
+		testCase{"example.com", ""},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equalf(t, testCase.rule, parsed.match(testCase.host), "host=%s", testCase.host)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "blocklist")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("MissingFile", func(t *testing.T) {
+		_, err := New(filepath.Join(dir, "missing.txt"))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		path := writeBlocklist(t, dir, "foo.com\n")
+
+		bl, err := New(path)
+		assert.Nil(t, err)
+		assert.Equal(t, "foo.com", bl.Match("foo.com"))
+		assert.Equal(t, "", bl.Match("bar.com"))
+
+		writeBlocklist(t, dir, "bar.com\n")
+		assert.Nil(t, bl.Reload())
+		assert.Equal(t, "", bl.Match("foo.com"))
+		assert.Equal(t, "bar.com", bl.Match("bar.com"))
+	})
+
+	t.Run("ReloadBrokenKeepsRules", func(t *testing.T) {
+		path := writeBlocklist(t, dir, "foo.com\n")
+
+		bl, err := New(path)
+		assert.Nil(t, err)
+
+		writeBlocklist(t, dir, "/[/\n")
+		assert.NotNil(t, bl.Reload())
+		assert.Equal(t, "foo.com", bl.Match("foo.com"))
+	})
+
+	t.Run("WatchFileChange", func(t *testing.T) {
+		path := writeBlocklist(t, dir, "foo.com\n")
+
+		bl, err := New(path)
+		assert.Nil(t, err)
+
+		bl.Watch(10 * time.Millisecond)
+		defer bl.Close()
+
+		writeBlocklist(t, dir, "bar.com\n")
+
+		// make sure the modification time differs on file systems with a coarse resolution
+		later := time.Now().Add(time.Minute)
+		assert.Nil(t, os.Chtimes(path, later, later))
+
+		assert.Eventually(t, func() bool {
+			return bl.Match("bar.com") != ""
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("WatchHangup", func(t *testing.T) {
+		path := writeBlocklist(t, dir, "foo.com\n")
+
+		bl, err := New(path)
+		assert.Nil(t, err)
+
+		// polling is effectively disabled, only the signal can trigger a reload
+		bl.Watch(time.Hour)
+		defer bl.Close()
+
+		writeBlocklist(t, dir, "bar.com\n")
+		assert.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGHUP))
+
+		assert.Eventually(t, func() bool {
+			return bl.Match("bar.com") != ""
+		}, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,22 @@
+package blocklist
+
+import "github.com/stretchr/testify/mock"
+
+// Interface is the external interface of the Blocklist
+type Interface interface {
+	Match(host string) string
+}
+
+var _ Interface = (*Blocklist)(nil)
+var _ Interface = (*MockBlocklist)(nil)
+
+// MockBlocklist is a struct for external testing
+type MockBlocklist struct {
+	mock.Mock
+}
+
+// Match mocks finding the rule blocking links to a host
+func (mb *MockBlocklist) Match(host string) string {
+	args := mb.Called(host)
+	return args.String(0)
+}
@@ -1,26 +1,42 @@
 package botstopper
 
 import (
-	"fmt"
-	"math/rand"
-	"sync"
+	"crypto/hmac"
 	"time"
-)
 
-const (
-	answerExpiry      = 10 * time.Minute
-	letters           = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	challengeIDLength = 10
-	maxSavedAnswers   = 1000
+	"golang.org/x/text/language"
 )
 
+const answerExpiry = 10 * time.Minute
+
 // Challenge is sent to the front-end for the user to answer it to verify if they are a bot
 type Challenge struct {
-	// ID identifies the answer of this challenge when verifying
+	// ID is a signed token identifying the answer of this challenge when verifying
 	ID string `json:"id"`
 
-	// Question is what the user gets to see
+	// Question is what the user gets to see, for proof of work challenges this is the nonce
 	Question string `json:"question"`
+
+	// Kind tells the front-end how to answer this challenge
+	Kind string `json:"kind"`
+
+	// Language is the BCP 47 tag of the question, empty if it does not depend on a language
+	Language string `json:"language,omitempty"`
+
+	// Difficulty is the number of leading zero bits a proof of work needs
+	Difficulty int `json:"difficulty,omitempty"`
+
+	// ExpiresAt is the unix time after which answers are no longer accepted
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// Request describes who asks for a challenge
+type Request struct {
+	// Client identifies the user, usually by IP address
+	Client string
+
+	// AcceptLanguage is the Accept-Language header of the user, used to pick a question
+	AcceptLanguage string
 }
 
 // Response is used to verify if a user is a bot
@@ -30,105 +46,103 @@ type Response struct {
 
 	// Answer is the actual answer a user would type on the form
 	Answer string `json:"challenge-answer"`
-}
 
-type answer struct {
-	expiry time.Time
-	value  string
+	// Client identifies the user like in Request, it is filled in by the server
+	Client string `json:"-"`
 }
 
-// BotStopper implements custom anti bot flooding
+// BotStopper implements custom anti bot flooding with simple questions
 type BotStopper struct {
-	mutex sync.Mutex
-
-	// answers are identified by challenge ID
-	answers map[string]answer
+	signer  *signer
+	sources []Source
 }
 
-// NewBotStopper returns an initialized Botstopper
-func NewBotStopper() *BotStopper {
+// NewBotStopper returns an initialized Botstopper. Challenges are signed with secret,
+// when it is empty a random one is used and challenges don't survive a restart.
+// Questions are picked from a random source, without sources only arithmetic is asked.
+func NewBotStopper(secret []byte, sources ...Source) *BotStopper {
+
+	if len(sources) == 0 {
+		sources = []Source{Arithmetic{}}
+	}
+
 	return &BotStopper{
-		answers: make(map[string]answer),
+		signer:  newSigner(secret),
+		sources: sources,
 	}
 }
 
-// GetChallenge generates a new challenge
-func (bs *BotStopper) GetChallenge() Challenge {
-
-	answer := &answer{expiry: time.Now().Add(answerExpiry)}
-	var challenge Challenge
+// SetReplayStore makes the BotStopper remember redeemed tokens in store instead of in memory,
+// which is needed when servers share the secret. It should be called before answers are verified.
+func (bs *BotStopper) SetReplayStore(store ReplayStore) {
+	bs.signer.used = store
+}
 
-	a := 1 + rand.Intn(9)
-	b := 1 + rand.Intn(9)
+// question picks a question from a random source, falling back to arithmetic
+func (bs *BotStopper) question(languages []language.Tag) Question {
 
-	switch rand.Intn(4) {
-	case 0:
-		challenge.Question = fmt.Sprintf("%d+%d=", a, b)
-		answer.value = fmt.Sprintf("%d", a+b)
-	case 1:
-		if a < b {
-			a, b = b, a
+	offset := randomInt(len(bs.sources))
+	for i := range bs.sources {
+		source := bs.sources[(offset+i)%len(bs.sources)]
+		if question, ok := source.Question(languages); ok {
+			return question
 		}
-		challenge.Question = fmt.Sprintf("%d-%d=", a, b)
-		answer.value = fmt.Sprintf("%d", a-b)
-	case 2:
-		challenge.Question = fmt.Sprintf("%dx%d=", a, b)
-		answer.value = fmt.Sprintf("%d", a*b)
-	case 3:
-		challenge.Question = fmt.Sprintf("%d/%d=", a*b, b)
-		answer.value = fmt.Sprintf("%d", a)
 	}
 
-	challenge.ID = bs.saveAnswer(answer)
-	return challenge
+	question, _ := Arithmetic{}.Question(languages)
+	return question
 }
 
-// saveAnswer saves an answer and returns its ID for future verification
-func (bs *BotStopper) saveAnswer(a *answer) string {
-
-	ID := make([]byte, challengeIDLength)
-	for i := range ID {
-		ID[i] = letters[rand.Intn(len(letters))]
-	}
-
-	IDString := string(ID)
-
-	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
+// GetChallenge generates a new challenge
+func (bs *BotStopper) GetChallenge(request Request) Challenge {
 
-	if len(bs.answers) >= maxSavedAnswers {
-		// we hit the map size cap, remove expired answers
-		now := time.Now()
-		for key := range bs.answers {
-			if now.After(bs.answers[key].expiry) {
-				delete(bs.answers, key)
-			}
-		}
+	now := time.Now()
+	languages, _, _ := language.ParseAcceptLanguage(request.AcceptLanguage)
+	question := bs.question(languages)
 
-		// pruning old answers didn't help, so we prune everything
-		// when this happens probably we are flooded by bots, so it's ok
-		if len(bs.answers) >= maxSavedAnswers {
-			bs.answers = make(map[string]answer, maxSavedAnswers)
-		}
+	payload := tokenPayload{
+		Nonce:     randomNonce(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(answerExpiry).Unix(),
+		Client:    request.Client,
 	}
 
-	// ignore very rare case that IDstring was already used
-	bs.answers[IDString] = *a
+	for _, answer := range question.Answers {
+		payload.AnswerMACs = append(payload.AnswerMACs,
+			bs.signer.answerMAC(payload.Nonce, normalizeAnswer(answer)))
+	}
 
-	return IDString
+	return Challenge{
+		ID:        bs.signer.sign(payload),
+		Question:  question.Text,
+		Kind:      KindArithmetic,
+		Language:  question.Language,
+		ExpiresAt: payload.ExpiresAt,
+	}
 }
 
-// Verify actually checks if a user entered the right answer for a challenge
+// Verify actually checks if a user entered one of the accepted answers for a challenge
 func (bs *BotStopper) Verify(response Response) bool {
-	bs.mutex.Lock()
-	defer bs.mutex.Unlock()
 
-	savedAnswer, ok := bs.answers[response.ID]
-	if !ok {
+	payload, err := bs.signer.redeem(response.ID, response.Client, time.Now())
+	if err != nil {
 		return false
 	}
 
-	delete(bs.answers, response.ID)
+	actual := []byte(bs.signer.answerMAC(payload.Nonce, normalizeAnswer(response.Answer)))
+
+	accepted := false
+	for _, expected := range payload.AnswerMACs {
+		// check all answers so timing doesn't reveal which one matched
+		if hmac.Equal([]byte(expected), actual) {
+			accepted = true
+		}
+	}
+
+	return accepted
+}
 
-	return time.Now().Before(savedAnswer.expiry) && response.Answer == savedAnswer.value
+// IssuedAt returns when the challenge of a response was issued, with a resolution of seconds
+func (bs *BotStopper) IssuedAt(response Response) (time.Time, error) {
+	return bs.signer.issuedAt(response.ID, time.Now())
 }
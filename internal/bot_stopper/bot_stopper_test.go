@@ -1,202 +1,200 @@
 package botstopper
 
 import (
-	"math/rand"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestBotStopperGetChallenge(t *testing.T) {
-
-	t.Run("One", func(t *testing.T) {
-		bs := NewBotStopper()
-		challenge := bs.GetChallenge()
-
-		assert.Equal(t, 1, len(bs.answers))
-		assert.Contains(t, bs.answers, challenge.ID)
-	})
-
-	t.Run("Many", func(t *testing.T) {
-		bs := NewBotStopper()
+// answerQuestion solves an arithmetic question like a user would
+func answerQuestion(t *testing.T, question string) string {
 
-		count := maxSavedAnswers - 1
-
-		challenges := make([]Challenge, count)
-		for i := 0; i < count; i++ {
-			challenges[i] = bs.GetChallenge()
-		}
-
-		assert.Equal(t, count, len(bs.answers))
-		for _, challenge := range challenges {
-			assert.Contains(t, bs.answers, challenge.ID)
-		}
-	})
+	var a, b int
+	var operator rune
 
-	t.Run("ManyParallel", func(t *testing.T) {
-		bs := NewBotStopper()
-
-		count := maxSavedAnswers - 1
-
-		challenges := make([]Challenge, count)
-		ch := make(chan Challenge, count)
-
-		for i := 0; i < count; i++ {
-			go func() {
-				ch <- bs.GetChallenge()
-			}()
-		}
-
-		// await receiving all pending challenges
-		for i := 0; i < count; i++ {
-			challenges[i] = <-ch
-		}
-
-		assert.Equal(t, count, len(bs.answers))
-		for _, challenge := range challenges {
-			assert.Contains(t, bs.answers, challenge.ID)
-		}
-	})
+	_, err := fmt.Sscanf(question, "%d%c%d=", &a, &operator, &b)
+	assert.Nil(t, err)
 
-	t.Run("HitCap", func(t *testing.T) {
-		bs := NewBotStopper()
+	switch operator {
+	case '+':
+		return fmt.Sprintf("%d", a+b)
+	case '-':
+		return fmt.Sprintf("%d", a-b)
+	case 'x':
+		return fmt.Sprintf("%d", a*b)
+	case '/':
+		return fmt.Sprintf("%d", a/b)
+	}
 
-		count := maxSavedAnswers + 1
+	t.Fatalf("unknown question %s", question)
+	return ""
+}
 
-		challenges := make([]Challenge, count)
-		ch := make(chan Challenge, count)
+func TestBotStopperGetChallenge(t *testing.T) {
 
-		for i := 0; i < count; i++ {
-			go func() {
-				ch <- bs.GetChallenge()
-			}()
-		}
+	t.Run("One", func(t *testing.T) {
+		bs := NewBotStopper(nil)
+		challenge := bs.GetChallenge(Request{})
 
-		// await receiving all pending challenges
-		for i := 0; i < count; i++ {
-			challenges[i] = <-ch
-		}
+		assert.Equal(t, KindArithmetic, challenge.Kind)
+		assert.True(t, challenge.ExpiresAt > time.Now().Unix())
+		assert.Regexp(t, `^[0-9]+[-+x/][0-9]+=$`, challenge.Question)
 
-		assert.Equal(t, 1, len(bs.answers))
+		// the ID only carries a MAC of the answer
+		payload, err := bs.signer.open(challenge.ID, time.Now())
+		assert.Nil(t, err)
+		assert.NotEmpty(t, payload.AnswerMACs)
 	})
 
-	t.Run("HitCapAndPrune", func(t *testing.T) {
-		// fake some expired challenges and check if they are pruned when hitting the cap
-		bs := NewBotStopper()
-
-		count := maxSavedAnswers + 1
-		nonExpired := 20
-
-		challenges := make([]Challenge, count)
+	t.Run("UniqueIDs", func(t *testing.T) {
+		bs := NewBotStopper(nil)
 
+		count := 1000
+		IDs := make(map[string]struct{}, count)
 		for i := 0; i < count; i++ {
-			challenge := bs.GetChallenge()
-			challenges[i] = challenge
-			if i >= nonExpired {
-				bs.answers[challenge.ID] = answer{
-					expiry: time.Now().Add(-time.Second),
-				}
-			}
+			IDs[bs.GetChallenge(Request{}).ID] = struct{}{}
 		}
 
-		assert.Equal(t, nonExpired+1, len(bs.answers))
-		for i := 0; i < nonExpired; i++ {
-			assert.Contains(t, bs.answers, challenges[i].ID)
-		}
+		assert.Equal(t, count, len(IDs))
 	})
 
-	t.Run("HitCapAndBeyond", func(t *testing.T) {
-		// Check if we continue as usual after pruning all saved answers
-
-		bs := NewBotStopper()
+	t.Run("Stateless", func(t *testing.T) {
+		bs := NewBotStopper(nil)
 
-		beyond := 20
-		count := maxSavedAnswers + beyond
-
-		challenges := make([]Challenge, count)
-		ch := make(chan Challenge, count)
-
-		for i := 0; i < count; i++ {
-			go func() {
-				ch <- bs.GetChallenge()
-			}()
+		for i := 0; i < 1000; i++ {
+			bs.GetChallenge(Request{})
 		}
 
-		// await receiving all pending challenges
-		for i := 0; i < count; i++ {
-			challenges[i] = <-ch
+		// issuing challenges should not store anything
+		for _, shard := range bs.signer.used.(*replayStore).shards {
+			assert.Equal(t, 0, shard.size)
 		}
-
-		assert.Equal(t, beyond, len(bs.answers))
-
-		found := 0
-		for _, challenge := range challenges {
-			if _, ok := bs.answers[challenge.ID]; ok {
-				found++
-			}
-		}
-		assert.Equal(t, beyond, found)
 	})
 }
 
 func TestBotStopperVerify(t *testing.T) {
 
 	t.Run("OK", func(t *testing.T) {
-		bs := NewBotStopper()
-		challenge := bs.GetChallenge()
+		bs := NewBotStopper(nil)
+		challenge := bs.GetChallenge(Request{})
 		response := Response{
 			ID:     challenge.ID,
-			Answer: bs.answers[challenge.ID].value,
+			Answer: answerQuestion(t, challenge.Question),
 		}
 		assert.True(t, bs.Verify(response))
 	})
 
 	t.Run("OKParallel", func(t *testing.T) {
-		bs := NewBotStopper()
-		for i := 0; i < maxSavedAnswers; i++ {
-			go func() {
-				challenge := bs.GetChallenge()
-
-				bs.mutex.Lock()
-				answer := bs.answers[challenge.ID].value
-				bs.mutex.Unlock()
-
+		bs := NewBotStopper(nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 1000; i++ {
+			wg.Add(1)
+			go func(client string) {
+				defer wg.Done()
+				challenge := bs.GetChallenge(Request{Client: client})
 				response := Response{
 					ID:     challenge.ID,
-					Answer: answer,
+					Answer: answerQuestion(t, challenge.Question),
+					Client: client,
 				}
 				assert.True(t, bs.Verify(response))
-			}()
+			}(fmt.Sprintf("client%d", i))
 		}
+		wg.Wait()
 	})
 
 	t.Run("FailRandomlyParallel", func(t *testing.T) {
-		bs := NewBotStopper()
-		for i := 0; i < maxSavedAnswers; i++ {
-			go func() {
-				challenge := bs.GetChallenge()
+		bs := NewBotStopper(nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 1000; i++ {
+			wg.Add(1)
+			go func(client string) {
+				defer wg.Done()
+				challenge := bs.GetChallenge(Request{Client: client})
 
-				succeed := rand.Intn(2) == 0
+				succeed := randomInt(2) == 0
 
 				var answer string
 				if succeed {
-					bs.mutex.Lock()
-					answer = bs.answers[challenge.ID].value
-					bs.mutex.Unlock()
+					answer = answerQuestion(t, challenge.Question)
 				}
 
 				response := Response{
 					ID:     challenge.ID,
 					Answer: answer,
+					Client: client,
 				}
 				assert.Equal(t, succeed, bs.Verify(response))
-			}()
+			}(fmt.Sprintf("client%d", i))
 		}
+		wg.Wait()
+	})
+
+	t.Run("OKAfterRestart", func(t *testing.T) {
+		secret := NewSecret()
+		challenge := NewBotStopper(secret).GetChallenge(Request{})
+
+		response := Response{
+			ID:     challenge.ID,
+			Answer: answerQuestion(t, challenge.Question),
+		}
+		assert.True(t, NewBotStopper(secret).Verify(response))
+	})
+
+	t.Run("FailOtherSecret", func(t *testing.T) {
+		challenge := NewBotStopper(nil).GetChallenge(Request{})
+
+		response := Response{
+			ID:     challenge.ID,
+			Answer: answerQuestion(t, challenge.Question),
+		}
+		assert.False(t, NewBotStopper(nil).Verify(response))
+	})
+
+	t.Run("FailOtherClient", func(t *testing.T) {
+		bs := NewBotStopper(nil)
+		challenge := bs.GetChallenge(Request{Client: "1.2.3.4"})
+		response := Response{
+			ID:     challenge.ID,
+			Answer: answerQuestion(t, challenge.Question),
+			Client: "5.6.7.8",
+		}
+		assert.False(t, bs.Verify(response))
+
+		response.Client = "1.2.3.4"
+		assert.True(t, bs.Verify(response))
+	})
+
+	t.Run("FailReused", func(t *testing.T) {
+		bs := NewBotStopper(nil)
+		challenge := bs.GetChallenge(Request{})
+		response := Response{
+			ID:     challenge.ID,
+			Answer: answerQuestion(t, challenge.Question),
+		}
+		assert.True(t, bs.Verify(response))
+		assert.False(t, bs.Verify(response))
+	})
+
+	t.Run("FailReusedAfterWrongAnswer", func(t *testing.T) {
+		bs := NewBotStopper(nil)
+		challenge := bs.GetChallenge(Request{})
+
+		response := Response{ID: challenge.ID, Answer: "wrong"}
+		assert.False(t, bs.Verify(response))
+
+		response.Answer = answerQuestion(t, challenge.Question)
+		assert.False(t, bs.Verify(response))
 	})
 
 	t.Run("FailChallengeUnknown", func(t *testing.T) {
-		bs := NewBotStopper()
+		bs := NewBotStopper(nil)
 		response := Response{
 			ID:     "foo",
 			Answer: "bar",
@@ -205,30 +203,66 @@ func TestBotStopperVerify(t *testing.T) {
 	})
 
 	t.Run("FailChallengeExpired", func(t *testing.T) {
-		bs := NewBotStopper()
-		challenge := bs.GetChallenge()
+		bs := NewBotStopper(nil)
+		answer := "42"
 
-		bs.answers[challenge.ID] = answer{
-			expiry: time.Now().Add(-time.Second), // fake expired entry
-			value:  "foo",
+		// fake expired token
+		payload := tokenPayload{
+			Nonce:     randomNonce(),
+			ExpiresAt: time.Now().Add(-time.Second).Unix(),
 		}
+		payload.AnswerMACs = []string{bs.signer.answerMAC(payload.Nonce, answer)}
 
 		response := Response{
-			ID:     challenge.ID,
-			Answer: bs.answers[challenge.ID].value,
+			ID:     bs.signer.sign(payload),
+			Answer: answer,
+		}
+		assert.False(t, bs.Verify(response))
+	})
+
+	t.Run("FailChallengeTampered", func(t *testing.T) {
+		bs := NewBotStopper(nil)
+		challenge := bs.GetChallenge(Request{})
+
+		parts := strings.Split(challenge.ID, tokenSeparator)
+		payload, err := bs.signer.open(challenge.ID, time.Now())
+		assert.Nil(t, err)
+
+		// swap the payload for one with a known answer, keeping the old signature
+		// no question has a negative answer, so this always differs from the original payload
+		payload.AnswerMACs = []string{bs.signer.answerMAC(payload.Nonce, "-1")}
+		forged := strings.Split(bs.signer.sign(*payload), tokenSeparator)[0]
+
+		response := Response{
+			ID:     forged + tokenSeparator + parts[1],
+			Answer: "-1",
 		}
 		assert.False(t, bs.Verify(response))
 	})
 
 	t.Run("FailChallengeWrongAnswer", func(t *testing.T) {
-		bs := NewBotStopper()
-		challenge := bs.GetChallenge()
+		bs := NewBotStopper(nil)
+		challenge := bs.GetChallenge(Request{})
 
 		response := Response{
 			ID:     challenge.ID,
-			Answer: bs.answers[challenge.ID].value + "wrong", // force wrong answer
+			Answer: answerQuestion(t, challenge.Question) + "1", // force wrong answer
 		}
 		assert.False(t, bs.Verify(response))
 	})
+}
+
+func TestBotStopperIssuedAt(t *testing.T) {
+
+	bs := NewBotStopper(nil)
+	before := time.Now().Unix()
+	challenge := bs.GetChallenge(Request{})
+
+	issuedAt, err := bs.IssuedAt(Response{ID: challenge.ID})
+	assert.Nil(t, err)
+	assert.True(t, issuedAt.Unix() >= before)
+	assert.True(t, issuedAt.Unix() <= time.Now().Unix())
 
+	_, err = bs.IssuedAt(Response{ID: "foo"})
+	assert.Equal(t, errTokenMalformed, err)
 }
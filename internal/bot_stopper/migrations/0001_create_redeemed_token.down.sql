@@ -0,0 +1 @@
+DROP TABLE IF EXISTS botstopper_redeemed_token;
@@ -0,0 +1,10 @@
+-- Redeemed challenge tokens are remembered until they expire, so a token is only redeemed
+-- once by all servers sharing the challenge secret, also after a restart.
+CREATE TABLE botstopper_redeemed_token (
+    client text NOT NULL,
+    nonce text NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (client, nonce)
+);
+
+CREATE INDEX botstopper_redeemed_token_expires_at_idx ON botstopper_redeemed_token (expires_at);
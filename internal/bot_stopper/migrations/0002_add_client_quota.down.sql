@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS botstopper_watermark;
+
+DROP INDEX IF EXISTS botstopper_redeemed_token_bucket_idx;
+
+ALTER TABLE botstopper_redeemed_token
+    DROP COLUMN IF EXISTS issued_at,
+    DROP COLUMN IF EXISTS bucket;
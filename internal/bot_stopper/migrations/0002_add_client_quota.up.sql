@@ -0,0 +1,19 @@
+-- every bucket of a client keeps at most a quota of redeemed tokens, evicting its oldest ones
+ALTER TABLE botstopper_redeemed_token
+    ADD COLUMN bucket smallint NOT NULL DEFAULT 0,
+    ADD COLUMN issued_at timestamp with time zone NOT NULL DEFAULT now();
+
+ALTER TABLE botstopper_redeemed_token
+    ALTER COLUMN bucket DROP DEFAULT,
+    ALTER COLUMN issued_at DROP DEFAULT;
+
+CREATE INDEX botstopper_redeemed_token_bucket_idx ON botstopper_redeemed_token (client, bucket, issued_at);
+
+-- tokens of a bucket issued at or before its watermark are rejected, so evicted tokens cannot be replayed
+CREATE TABLE botstopper_watermark (
+    client text NOT NULL,
+    bucket smallint NOT NULL,
+    issued_at timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (client, bucket)
+);
@@ -1,14 +1,20 @@
 package botstopper
 
-import "github.com/stretchr/testify/mock"
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
 
 // Interface is the external interface of the BotStopper
 type Interface interface {
-	GetChallenge() Challenge
+	GetChallenge(request Request) Challenge
 	Verify(response Response) bool
+	IssuedAt(response Response) (time.Time, error)
 }
 
 var _ Interface = (*BotStopper)(nil)
+var _ Interface = (*ProofOfWork)(nil)
 var _ Interface = (*MockVerifier)(nil)
 
 // MockVerifier is a struct for external testing
@@ -23,7 +29,13 @@ func (mv *MockVerifier) Verify(response Response) bool {
 }
 
 // GetChallenge mocks returning a challenge
-func (mv *MockVerifier) GetChallenge() Challenge {
-	args := mv.Called()
+func (mv *MockVerifier) GetChallenge(request Request) Challenge {
+	args := mv.Called(request)
 	return args.Get(0).(Challenge)
 }
+
+// IssuedAt mocks returning when a challenge was issued
+func (mv *MockVerifier) IssuedAt(response Response) (time.Time, error) {
+	args := mv.Called(response)
+	return args.Get(0).(time.Time), args.Error(1)
+}
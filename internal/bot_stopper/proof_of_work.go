@@ -0,0 +1,161 @@
+package botstopper
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// KindArithmetic challenges are a question for the user to answer
+	KindArithmetic = "arithmetic"
+
+	// KindProofOfWork challenges are solved by the browser, see ProofOfWork
+	KindProofOfWork = "proof-of-work"
+)
+
+// ProofOfWorkConfig configures a ProofOfWork
+type ProofOfWorkConfig struct {
+	// BaseDifficulty is the number of leading zero bits required when traffic is normal
+	BaseDifficulty int
+
+	// MaxDifficulty caps the difficulty when challenge volume spikes
+	MaxDifficulty int
+
+	// SpikeThreshold is the number of challenges per minute above which difficulty increases
+	SpikeThreshold int
+
+	// Expiry is how long a challenge can be answered
+	Expiry time.Duration
+}
+
+// DefaultProofOfWorkConfig takes a browser roughly a second to solve under normal traffic
+var DefaultProofOfWorkConfig = ProofOfWorkConfig{
+	BaseDifficulty: 16,
+	MaxDifficulty:  22,
+	SpikeThreshold: 60,
+	Expiry:         answerExpiry,
+}
+
+// ProofOfWork implements hashcash-style anti bot flooding: a challenge is solved by finding
+// an answer such that SHA-256(nonce + ":" + answer) starts with difficulty zero bits.
+type ProofOfWork struct {
+	config ProofOfWorkConfig
+	signer *signer
+
+	mutex sync.Mutex
+
+	// issued counts challenges in the current and previous minute for adaptive difficulty
+	windowStart    time.Time
+	issued         int
+	previousIssued int
+}
+
+// NewProofOfWork returns an initialized ProofOfWork, secret is used like in NewBotStopper
+func NewProofOfWork(config ProofOfWorkConfig, secret []byte) *ProofOfWork {
+	return &ProofOfWork{
+		config:      config,
+		signer:      newSigner(secret),
+		windowStart: time.Now(),
+	}
+}
+
+// SetReplayStore is like BotStopper.SetReplayStore
+func (pow *ProofOfWork) SetReplayStore(store ReplayStore) {
+	pow.signer.used = store
+}
+
+// difficulty counts an issued challenge and returns the difficulty for it.
+// Every doubling of the challenge rate above the threshold adds one bit.
+// The mutex should be held when calling this.
+func (pow *ProofOfWork) difficulty(now time.Time) int {
+
+	elapsed := now.Sub(pow.windowStart)
+	if elapsed >= time.Minute {
+		pow.previousIssued = pow.issued
+		if elapsed >= 2*time.Minute {
+			pow.previousIssued = 0
+		}
+		pow.issued = 0
+		pow.windowStart = now
+	}
+
+	pow.issued++
+
+	rate := pow.issued
+	if pow.previousIssued > rate {
+		rate = pow.previousIssued
+	}
+
+	difficulty := pow.config.BaseDifficulty
+	for threshold := pow.config.SpikeThreshold; rate > threshold; threshold *= 2 {
+		difficulty++
+	}
+
+	if difficulty > pow.config.MaxDifficulty {
+		difficulty = pow.config.MaxDifficulty
+	}
+
+	return difficulty
+}
+
+// GetChallenge generates a new challenge
+func (pow *ProofOfWork) GetChallenge(request Request) Challenge {
+
+	now := time.Now()
+
+	pow.mutex.Lock()
+	difficulty := pow.difficulty(now)
+	pow.mutex.Unlock()
+
+	payload := tokenPayload{
+		Nonce:      randomNonce(),
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  now.Add(pow.config.Expiry).Unix(),
+		Difficulty: difficulty,
+		Client:     request.Client,
+	}
+
+	return Challenge{
+		ID:         pow.signer.sign(payload),
+		Kind:       KindProofOfWork,
+		Question:   payload.Nonce,
+		Difficulty: payload.Difficulty,
+		ExpiresAt:  payload.ExpiresAt,
+	}
+}
+
+// leadingZeroBits counts the zero bits at the start of hash
+func leadingZeroBits(hash []byte) int {
+	count := 0
+	for _, b := range hash {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
+
+// solves checks if answer is a valid proof of work for nonce
+func solves(nonce, answer string, difficulty int) bool {
+	hash := sha256.Sum256([]byte(nonce + ":" + answer))
+	return leadingZeroBits(hash[:]) >= difficulty
+}
+
+// Verify checks if the response contains a valid proof of work
+func (pow *ProofOfWork) Verify(response Response) bool {
+
+	payload, err := pow.signer.redeem(response.ID, response.Client, time.Now())
+	if err != nil {
+		return false
+	}
+
+	return solves(payload.Nonce, response.Answer, payload.Difficulty)
+}
+
+// IssuedAt returns when the challenge of a response was issued, with a resolution of seconds
+func (pow *ProofOfWork) IssuedAt(response Response) (time.Time, error) {
+	return pow.signer.issuedAt(response.ID, time.Now())
+}
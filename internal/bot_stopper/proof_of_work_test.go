@@ -0,0 +1,157 @@
+package botstopper
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testProofOfWorkConfig keeps solving cheap in tests
+var testProofOfWorkConfig = ProofOfWorkConfig{
+	BaseDifficulty: 8,
+	MaxDifficulty:  10,
+	SpikeThreshold: 10,
+	Expiry:         time.Minute,
+}
+
+// solve brute-forces a challenge like the front-end does
+func solve(challenge Challenge) string {
+	for i := 0; ; i++ {
+		answer := fmt.Sprintf("%d", i)
+		if solves(challenge.Question, answer, challenge.Difficulty) {
+			return answer
+		}
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, leadingZeroBits([]byte{0xff}))
+	assert.Equal(t, 3, leadingZeroBits([]byte{0x10, 0x00}))
+	assert.Equal(t, 8, leadingZeroBits([]byte{0x00, 0xff}))
+	assert.Equal(t, 15, leadingZeroBits([]byte{0x00, 0x01}))
+	assert.Equal(t, 16, leadingZeroBits([]byte{0x00, 0x00}))
+}
+
+func TestProofOfWorkGetChallenge(t *testing.T) {
+
+	t.Run("One", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+		challenge := pow.GetChallenge(Request{})
+
+		assert.Equal(t, KindProofOfWork, challenge.Kind)
+		assert.Equal(t, testProofOfWorkConfig.BaseDifficulty, challenge.Difficulty)
+		assert.NotEmpty(t, challenge.Question)
+		assert.True(t, challenge.ExpiresAt > time.Now().Unix())
+	})
+
+	t.Run("AdaptiveDifficulty", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+
+		difficulties := make([]int, 50)
+		for i := range difficulties {
+			difficulties[i] = pow.GetChallenge(Request{}).Difficulty
+		}
+
+		// threshold 10 doubles to 20 and 40, but the maximum is 10
+		assert.Equal(t, 8, difficulties[9])
+		assert.Equal(t, 9, difficulties[10])
+		assert.Equal(t, 9, difficulties[19])
+		assert.Equal(t, 10, difficulties[20])
+		assert.Equal(t, 10, difficulties[49])
+	})
+
+	t.Run("DifficultyCoolsDown", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+
+		for i := 0; i < 20; i++ {
+			pow.GetChallenge(Request{})
+		}
+
+		// the previous minute still counts
+		pow.windowStart = pow.windowStart.Add(-time.Minute)
+		assert.Equal(t, 9, pow.GetChallenge(Request{}).Difficulty)
+
+		// but nothing older than that
+		pow.windowStart = pow.windowStart.Add(-2 * time.Minute)
+		assert.Equal(t, 8, pow.GetChallenge(Request{}).Difficulty)
+	})
+}
+
+func TestProofOfWorkVerify(t *testing.T) {
+
+	t.Run("OK", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+		challenge := pow.GetChallenge(Request{})
+
+		response := Response{ID: challenge.ID, Answer: solve(challenge)}
+		assert.True(t, pow.Verify(response))
+	})
+
+	t.Run("FailReused", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+		challenge := pow.GetChallenge(Request{})
+
+		response := Response{ID: challenge.ID, Answer: solve(challenge)}
+		assert.True(t, pow.Verify(response))
+		assert.False(t, pow.Verify(response))
+	})
+
+	t.Run("FailChallengeUnknown", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+		assert.False(t, pow.Verify(Response{ID: "foo", Answer: "bar"}))
+	})
+
+	t.Run("FailChallengeExpired", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+		challenge := pow.GetChallenge(Request{})
+		answer := solve(challenge)
+
+		// fake expired token for the same nonce
+		payload, err := pow.signer.open(challenge.ID, time.Now())
+		assert.Nil(t, err)
+		payload.ExpiresAt = time.Now().Add(-time.Second).Unix()
+
+		assert.False(t, pow.Verify(Response{ID: pow.signer.sign(*payload), Answer: answer}))
+	})
+
+	t.Run("FailWrongAnswer", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+		challenge := pow.GetChallenge(Request{})
+
+		// find an answer that does not solve the challenge
+		answer := ""
+		for i := 0; solves(challenge.Question, answer, challenge.Difficulty); i++ {
+			answer = fmt.Sprintf("wrong%d", i)
+		}
+
+		assert.False(t, pow.Verify(Response{ID: challenge.ID, Answer: answer}))
+	})
+
+	t.Run("FailLoweredDifficulty", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+
+		// claim a difficulty of zero without knowing the secret
+		forged := NewProofOfWork(testProofOfWorkConfig, nil)
+		payload, err := forged.signer.open(forged.GetChallenge(Request{}).ID, time.Now())
+		assert.Nil(t, err)
+		payload.Difficulty = 0
+
+		response := Response{ID: forged.signer.sign(*payload), Answer: "0"}
+		assert.False(t, pow.Verify(response))
+	})
+
+	t.Run("FailAnswerForOtherChallenge", func(t *testing.T) {
+		pow := NewProofOfWork(testProofOfWorkConfig, nil)
+		first := pow.GetChallenge(Request{})
+		second := pow.GetChallenge(Request{})
+
+		answer := solve(first)
+		if solves(second.Question, answer, second.Difficulty) {
+			t.Skip("answer happens to solve both challenges")
+		}
+
+		assert.False(t, pow.Verify(Response{ID: second.ID, Answer: answer}))
+	})
+}
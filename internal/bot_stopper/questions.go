@@ -0,0 +1,203 @@
+package botstopper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultLanguage is used when none of the languages of a user has a question bank
+const DefaultLanguage = "en"
+
+var errNoQuestionBanks = errors.New("no question banks found")
+
+// Question is a text question with all answers that are accepted
+type Question struct {
+	Text    string   `json:"question"`
+	Answers []string `json:"answers"`
+
+	// Language is the BCP 47 tag of the question, empty if it does not depend on a language
+	Language string `json:"-"`
+}
+
+// Source provides questions for the BotStopper
+type Source interface {
+	// Question returns a question preferably in one of languages, ok is false if there is none
+	Question(languages []language.Tag) (question Question, ok bool)
+}
+
+var _ Source = Arithmetic{}
+var _ Source = (*QuestionBanks)(nil)
+
+// Arithmetic generates simple arithmetic questions, which don't depend on a language
+type Arithmetic struct{}
+
+// Question generates an arithmetic question and its answer
+func (Arithmetic) Question(languages []language.Tag) (Question, bool) {
+
+	a := 1 + randomInt(9)
+	b := 1 + randomInt(9)
+
+	var text string
+	var answer int
+
+	switch randomInt(4) {
+	case 0:
+		text, answer = fmt.Sprintf("%d+%d=", a, b), a+b
+	case 1:
+		if a < b {
+			a, b = b, a
+		}
+		text, answer = fmt.Sprintf("%d-%d=", a, b), a-b
+	case 2:
+		text, answer = fmt.Sprintf("%dx%d=", a, b), a*b
+	default:
+		text, answer = fmt.Sprintf("%d/%d=", a*b, b), a
+	}
+
+	return Question{Text: text, Answers: []string{fmt.Sprintf("%d", answer)}}, true
+}
+
+// QuestionBanks holds text questions per language
+type QuestionBanks struct {
+	tags    []language.Tag
+	banks   [][]Question
+	matcher language.Matcher
+}
+
+// LoadQuestionBanks reads question banks from dir, one JSON file per language named after
+// its tag, for example en.json. Every file contains a list of questions with their answers.
+func LoadQuestionBanks(dir string) (*QuestionBanks, error) {
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: %w", dir, errNoQuestionBanks)
+	}
+
+	banks := make(map[language.Tag][]Question, len(paths))
+	for _, path := range paths {
+
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		tag, err := language.Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid language: %w", path, err)
+		}
+
+		questions, err := loadQuestionBank(path, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		banks[tag] = questions
+	}
+
+	return newQuestionBanks(banks), nil
+}
+
+// loadQuestionBank reads and validates a single question bank file
+func loadQuestionBank(path string, tag language.Tag) ([]Question, error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var questions []Question
+	if err = json.Unmarshal(content, &questions); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("%s: no questions", path)
+	}
+
+	for i := range questions {
+		if strings.TrimSpace(questions[i].Text) == "" {
+			return nil, fmt.Errorf("%s: question %d is empty", path, i+1)
+		}
+
+		answers := make([]string, 0, len(questions[i].Answers))
+		for _, answer := range questions[i].Answers {
+			if answer = normalizeAnswer(answer); answer != "" {
+				answers = append(answers, answer)
+			}
+		}
+
+		if len(answers) == 0 {
+			return nil, fmt.Errorf("%s: question %d has no answers", path, i+1)
+		}
+
+		questions[i].Answers = answers
+		questions[i].Language = tag.String()
+	}
+
+	return questions, nil
+}
+
+// newQuestionBanks builds QuestionBanks, the default language comes first so it is
+// what the matcher falls back to
+func newQuestionBanks(banks map[language.Tag][]Question) *QuestionBanks {
+
+	defaultTag := language.Make(DefaultLanguage)
+
+	tags := make([]language.Tag, 0, len(banks))
+	for tag := range banks {
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if (tags[i] == defaultTag) != (tags[j] == defaultTag) {
+			return tags[i] == defaultTag
+		}
+		return tags[i].String() < tags[j].String()
+	})
+
+	qb := &QuestionBanks{
+		tags:    tags,
+		banks:   make([][]Question, len(tags)),
+		matcher: language.NewMatcher(tags),
+	}
+
+	for i, tag := range tags {
+		qb.banks[i] = banks[tag]
+	}
+
+	return qb
+}
+
+// Languages returns the tags of all loaded languages, the default one first
+func (qb *QuestionBanks) Languages() []string {
+	languages := make([]string, len(qb.tags))
+	for i, tag := range qb.tags {
+		languages[i] = tag.String()
+	}
+	return languages
+}
+
+// Question picks a random question in the best matching language
+func (qb *QuestionBanks) Question(languages []language.Tag) (Question, bool) {
+
+	if len(qb.banks) == 0 {
+		return Question{}, false
+	}
+
+	_, index, _ := qb.matcher.Match(languages...)
+	bank := qb.banks[index]
+
+	return bank[randomInt(len(bank))], true
+}
+
+// normalizeAnswer makes answers comparable regardless of case and whitespace
+func normalizeAnswer(answer string) string {
+	return strings.Join(strings.Fields(strings.ToLower(answer)), " ")
+}
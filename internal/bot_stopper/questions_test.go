@@ -0,0 +1,147 @@
+package botstopper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+// writeQuestionBanks creates a directory with a question bank file per name
+func writeQuestionBanks(t *testing.T, files map[string]string) string {
+
+	dir, err := ioutil.TempDir("", "questions")
+	assert.Nil(t, err)
+
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		assert.Nil(t, err)
+	}
+
+	return dir
+}
+
+func TestLoadQuestionBanks(t *testing.T) {
+
+	t.Run("OK", func(t *testing.T) {
+		dir := writeQuestionBanks(t, map[string]string{
+			"nl.json": `[{"question": "Welke kleur heeft gras?", "answers": ["Groen "]}]`,
+			"en.json": `[{"question": "What colour is grass?", "answers": ["green"]}]`,
+		})
+		defer os.RemoveAll(dir)
+
+		banks, err := LoadQuestionBanks(dir)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"en", "nl"}, banks.Languages())
+
+		// answers are stored normalized
+		question, ok := banks.Question([]language.Tag{language.Dutch})
+		assert.True(t, ok)
+		assert.Equal(t, Question{Text: "Welke kleur heeft gras?", Answers: []string{"groen"}, Language: "nl"}, question)
+	})
+
+	t.Run("Shipped", func(t *testing.T) {
+		banks, err := LoadQuestionBanks("../../conf/questions")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"en", "nl"}, banks.Languages())
+	})
+
+	failing := map[string]map[string]string{
+		"NoFiles":         {},
+		"InvalidLanguage": {"english!.json": `[{"question": "q", "answers": ["a"]}]`},
+		"InvalidJSON":     {"en.json": `[{"question": `},
+		"NoQuestions":     {"en.json": `[]`},
+		"EmptyQuestion":   {"en.json": `[{"question": " ", "answers": ["a"]}]`},
+		"NoAnswers":       {"en.json": `[{"question": "q", "answers": [" "]}]`},
+	}
+
+	for name, files := range failing {
+		files := files
+		t.Run(name, func(t *testing.T) {
+			dir := writeQuestionBanks(t, files)
+			defer os.RemoveAll(dir)
+
+			banks, err := LoadQuestionBanks(dir)
+			assert.NotNil(t, err)
+			assert.Nil(t, banks)
+		})
+	}
+}
+
+func TestQuestionBanksQuestion(t *testing.T) {
+
+	banks := newQuestionBanks(map[language.Tag][]Question{
+		language.Dutch:   {{Text: "nl", Answers: []string{"a"}, Language: "nl"}},
+		language.English: {{Text: "en", Answers: []string{"a"}, Language: "en"}},
+	})
+
+	tests := map[string]string{
+		"":                          "en",
+		"nl":                        "nl",
+		"nl-BE":                     "nl",
+		"en-GB,en;q=0.9":            "en",
+		"de-DE,nl;q=0.8,en;q=0.7":   "nl",
+		"fr,en;q=0.5,nl;q=0.4":      "en",
+		"de":                        "en",
+		"this is not a header ;;;;": "en",
+	}
+
+	for header, expected := range tests {
+		languages, _, _ := language.ParseAcceptLanguage(header)
+		question, ok := banks.Question(languages)
+		assert.True(t, ok)
+		assert.Equal(t, expected, question.Language, header)
+	}
+
+	empty := newQuestionBanks(nil)
+	_, ok := empty.Question(nil)
+	assert.False(t, ok)
+}
+
+func TestNormalizeAnswer(t *testing.T) {
+	assert.Equal(t, "light blue", normalizeAnswer("  Light \t BLUE\n"))
+	assert.Equal(t, "ijs", normalizeAnswer("IJS"))
+	assert.Equal(t, "", normalizeAnswer(" "))
+}
+
+func TestBotStopperQuestionBanks(t *testing.T) {
+
+	banks := newQuestionBanks(map[language.Tag][]Question{
+		language.Dutch: {{Text: "Welke kleur heeft de lucht?", Answers: []string{"blauw", "lichtblauw"}, Language: "nl"}},
+	})
+	bs := NewBotStopper(nil, banks)
+
+	t.Run("Challenge", func(t *testing.T) {
+		challenge := bs.GetChallenge(Request{AcceptLanguage: "nl-NL,nl;q=0.9"})
+		assert.Equal(t, KindArithmetic, challenge.Kind)
+		assert.Equal(t, "Welke kleur heeft de lucht?", challenge.Question)
+		assert.Equal(t, "nl", challenge.Language)
+	})
+
+	answers := map[string]bool{
+		"blauw":         true,
+		" BLAUW ":       true,
+		"Licht  Blauw":  false,
+		"lichtblauw":    true,
+		"LichtBlauw\n":  true,
+		"groen":         false,
+		"":              false,
+		"blauw, groen!": false,
+	}
+
+	for answer, expected := range answers {
+		challenge := bs.GetChallenge(Request{})
+		response := Response{ID: challenge.ID, Answer: answer}
+		assert.Equal(t, expected, bs.Verify(response), answer)
+	}
+
+	t.Run("FallbackToArithmetic", func(t *testing.T) {
+		bs := NewBotStopper(nil, newQuestionBanks(nil))
+		challenge := bs.GetChallenge(Request{})
+		assert.Regexp(t, `^[0-9]+[-+x/][0-9]+=$`, challenge.Question)
+		assert.Empty(t, challenge.Language)
+	})
+}
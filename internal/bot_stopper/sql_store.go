@@ -0,0 +1,147 @@
+package botstopper
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"sync"
+	"time"
+
+	"github.com/lk16/heyluuk/internal/migrate"
+)
+
+// MigrationComponent identifies the migrations of this package in the schema_migrations table
+const MigrationComponent = "botstopper"
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator returns a Migrator for the versioned schema migrations of this package
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+
+	migrations, err := migrate.Load(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, MigrationComponent, migrations), nil
+}
+
+// Migrate applies all pending DB migrations
+func Migrate(db *sql.DB) error {
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up(context.Background())
+	return err
+}
+
+// SQLStore remembers redeemed tokens in the database, so tokens are redeemed only once by
+// all servers sharing the challenge secret, also after a restart. Like the in-memory store
+// every bucket of a client has a quota, so a client redeeming lots of tokens only evicts its
+// own oldest ones. Buckets are locked on their own, so clients do not wait for each other.
+type SQLStore struct {
+	db *sql.DB
+
+	mutex     sync.Mutex
+	lastPrune time.Time
+}
+
+// NewSQLStore returns a SQLStore using the tables created by the migrations of this package
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// pruneExpired removes expired tokens and watermarks once every replayPruneInterval, they are rejected anyway
+func (s *SQLStore) pruneExpired(now time.Time) error {
+
+	s.mutex.Lock()
+	due := now.Sub(s.lastPrune) > replayPruneInterval
+	if due {
+		s.lastPrune = now
+	}
+	s.mutex.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	if _, err := s.db.Exec("DELETE FROM botstopper_redeemed_token WHERE expires_at <= $1", now); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec("DELETE FROM botstopper_watermark WHERE expires_at <= $1", now)
+	return err
+}
+
+// Redeem records a token redeemed by client in the database
+func (s *SQLStore) Redeem(client string, token RedeemedToken, now time.Time) (bool, error) {
+
+	if err := s.pruneExpired(now); err != nil {
+		return false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	// this is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	fresh, err := redeemInBucket(tx, client, bucketIndex(token.Nonce), token, now)
+	if err != nil || !fresh {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// redeemInBucket records a token in a bucket of a client and evicts the oldest tokens over
+// its quota, raising the watermark of the bucket so evicted tokens cannot be replayed
+func redeemInBucket(tx *sql.Tx, client string, bucket int, token RedeemedToken, now time.Time) (bool, error) {
+
+	// redeeming the tokens of a bucket one at a time keeps its quota exact
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1), $2)", client, bucket); err != nil {
+		return false, err
+	}
+
+	var belowWatermark bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM botstopper_watermark
+		WHERE client = $1 AND bucket = $2 AND issued_at >= $3 AND expires_at > $4)`,
+		client, bucket, token.IssuedAt, now).Scan(&belowWatermark)
+	if err != nil || belowWatermark {
+		return false, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO botstopper_redeemed_token (client, bucket, nonce, issued_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`, client, bucket, token.Nonce, token.IssuedAt, token.ExpiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil || inserted != 1 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`WITH evicted AS (
+			DELETE FROM botstopper_redeemed_token WHERE client = $1 AND nonce IN (
+				SELECT nonce FROM botstopper_redeemed_token WHERE client = $1 AND bucket = $2
+				ORDER BY issued_at DESC, nonce DESC OFFSET $3)
+			RETURNING issued_at, expires_at)
+		INSERT INTO botstopper_watermark (client, bucket, issued_at, expires_at)
+		SELECT $1, $2, max(issued_at), max(expires_at) FROM evicted HAVING count(*) > 0
+		ON CONFLICT (client, bucket) DO UPDATE SET
+			issued_at = GREATEST(botstopper_watermark.issued_at, excluded.issued_at),
+			expires_at = GREATEST(botstopper_watermark.expires_at, excluded.expires_at)`,
+		client, bucket, replayClientQuota)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,216 @@
+package botstopper
+
+import (
+	"container/list"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	replayShards        = 16
+	replayClientQuota   = 50
+	replayShardCapacity = maxUsedNonces / replayShards
+	replayPruneInterval = time.Minute
+
+	// replayClientBuckets splits the nonces of a client by token, so a full quota only
+	// rejects the pending tokens of one bucket of a client, like a shared IP address
+	replayClientBuckets = 16
+)
+
+// RedeemedToken identifies a redeemed challenge token until it expires
+type RedeemedToken struct {
+	Nonce     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// ReplayStore remembers redeemed tokens until they expire, so every token is redeemed only once
+type ReplayStore interface {
+	// Redeem records a token redeemed by client, it returns false if it was redeemed before
+	Redeem(client string, token RedeemedToken, now time.Time) (bool, error)
+}
+
+var _ ReplayStore = (*replayStore)(nil)
+var _ ReplayStore = (*SQLStore)(nil)
+
+// usedNonce is a redeemed token remembered until it expires
+type usedNonce struct {
+	nonce    string
+	issuedAt int64
+	expiry   time.Time
+}
+
+// clientNonces are the redeemed tokens of one bucket of a client, oldest first
+type clientNonces struct {
+	order  *list.List
+	byName map[string]*list.Element
+
+	// watermark rejects all tokens issued at or before it, so evicted nonces cannot be replayed
+	watermark       int64
+	watermarkExpiry time.Time
+}
+
+func newClientNonces() *clientNonces {
+	return &clientNonces{
+		order:  list.New(),
+		byName: make(map[string]*list.Element),
+	}
+}
+
+// evictOldest forgets the oldest nonce of a bucket and raises its watermark
+func (cn *clientNonces) evictOldest() {
+
+	element := cn.order.Front()
+	used := element.Value.(usedNonce)
+
+	cn.order.Remove(element)
+	delete(cn.byName, used.nonce)
+
+	if used.issuedAt > cn.watermark {
+		cn.watermark = used.issuedAt
+	}
+
+	if used.expiry.After(cn.watermarkExpiry) {
+		cn.watermarkExpiry = used.expiry
+	}
+}
+
+// pruneExpired forgets nonces of tokens that are rejected anyway
+func (cn *clientNonces) pruneExpired(now time.Time) int {
+
+	pruned := 0
+	for element := cn.order.Front(); element != nil; {
+		next := element.Next()
+		used := element.Value.(usedNonce)
+		if !now.Before(used.expiry) {
+			cn.order.Remove(element)
+			delete(cn.byName, used.nonce)
+			pruned++
+		}
+		element = next
+	}
+	return pruned
+}
+
+// replayShard holds the buckets of the clients whose name hashes to it
+type replayShard struct {
+	mutex     sync.Mutex
+	buckets   map[string]*clientNonces
+	size      int
+	lastPrune time.Time
+}
+
+// pruneExpired removes expired nonces and buckets without anything left to remember
+func (rs *replayShard) pruneExpired(now time.Time) {
+	rs.lastPrune = now
+	for name, nonces := range rs.buckets {
+		rs.size -= nonces.pruneExpired(now)
+		if nonces.order.Len() == 0 && !now.Before(nonces.watermarkExpiry) {
+			delete(rs.buckets, name)
+		}
+	}
+}
+
+// evictFromLargest evicts the oldest nonce of the bucket with most nonces, which is the flooder
+func (rs *replayShard) evictFromLargest() {
+
+	var largest *clientNonces
+	for _, nonces := range rs.buckets {
+		if largest == nil || nonces.order.Len() > largest.order.Len() {
+			largest = nonces
+		}
+	}
+
+	largest.evictOldest()
+	rs.size--
+}
+
+// replayStore remembers nonces of redeemed tokens in memory until they expire. It only
+// protects a single process, so servers sharing a secret or restarting use a SQLStore.
+// Clients are spread over shards with their own lock, and every bucket of a client has a
+// quota, so a client redeeming lots of tokens only evicts its own nonces. Tokens are bound to
+// the client they were issued to, so a nonce never needs to be looked up for other clients.
+type replayStore struct {
+	shards [replayShards]*replayShard
+}
+
+func newReplayStore() *replayStore {
+	rs := &replayStore{}
+	for i := range rs.shards {
+		rs.shards[i] = &replayShard{buckets: make(map[string]*clientNonces)}
+	}
+	return rs
+}
+
+func hash32(s string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(s))
+	return hash.Sum32()
+}
+
+func (rs *replayStore) shard(client string) *replayShard {
+	return rs.shards[hash32(client)%replayShards]
+}
+
+// bucketIndex returns which of the buckets of a client a nonce is remembered in
+func bucketIndex(nonce string) int {
+	return int(hash32(nonce) % replayClientBuckets)
+}
+
+// bucket returns the name of the bucket of a client a nonce is remembered in
+func bucket(client, nonce string) string {
+	return client + "\x00" + strconv.Itoa(bucketIndex(nonce))
+}
+
+// add records a nonce for a client, it returns false if the nonce was recorded before
+// or the token was issued before nonces of its bucket were evicted
+func (rs *replayStore) add(client string, used usedNonce, now time.Time) bool {
+
+	shard := rs.shard(client)
+	name := bucket(client, used.nonce)
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if shard.size >= replayShardCapacity || now.Sub(shard.lastPrune) > replayPruneInterval {
+		shard.pruneExpired(now)
+	}
+
+	nonces, ok := shard.buckets[name]
+	if !ok {
+		nonces = newClientNonces()
+		shard.buckets[name] = nonces
+	}
+
+	if _, ok := nonces.byName[used.nonce]; ok {
+		return false
+	}
+
+	if used.issuedAt <= nonces.watermark {
+		return false
+	}
+
+	if nonces.order.Len() >= replayClientQuota {
+		nonces.evictOldest()
+		shard.size--
+	}
+
+	if shard.size >= replayShardCapacity {
+		shard.evictFromLargest()
+	}
+
+	nonces.byName[used.nonce] = nonces.order.PushBack(used)
+	shard.size++
+	return true
+}
+
+// Redeem records a token redeemed by client in memory
+func (rs *replayStore) Redeem(client string, token RedeemedToken, now time.Time) (bool, error) {
+	return rs.add(client, usedNonce{
+		nonce:    token.Nonce,
+		issuedAt: token.IssuedAt.Unix(),
+		expiry:   token.ExpiresAt,
+	}, now), nil
+}
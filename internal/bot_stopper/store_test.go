@@ -0,0 +1,290 @@
+package botstopper
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lk16/heyluuk/internal/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+// nonces returns count nonces of client, all in the same bucket
+func nonces(client, prefix string, count int) []string {
+	var result []string
+	for i := 0; len(result) < count; i++ {
+		nonce := fmt.Sprintf("%s%d", prefix, i)
+		if bucket(client, nonce) == bucket(client, prefix) {
+			result = append(result, nonce)
+		}
+	}
+	return result
+}
+
+func TestReplayStoreAdd(t *testing.T) {
+
+	now := time.Now()
+
+	newUsed := func(nonce string, issuedAt time.Time) usedNonce {
+		return usedNonce{
+			nonce:    nonce,
+			issuedAt: issuedAt.Unix(),
+			expiry:   issuedAt.Add(answerExpiry),
+		}
+	}
+
+	t.Run("Duplicate", func(t *testing.T) {
+		rs := newReplayStore()
+		assert.True(t, rs.add("a", newUsed("foo", now), now))
+		assert.False(t, rs.add("a", newUsed("foo", now), now))
+		assert.True(t, rs.add("a", newUsed("bar", now), now))
+	})
+
+	t.Run("PruneExpired", func(t *testing.T) {
+		rs := newReplayStore()
+		issued := now.Add(-2 * answerExpiry)
+		assert.True(t, rs.add("a", newUsed("foo", issued), issued))
+
+		later := now.Add(2 * replayPruneInterval)
+		assert.True(t, rs.add("a", newUsed("bar", later), later))
+
+		shard := rs.shard("a")
+		assert.Equal(t, 1, shard.size)
+		if nonces, ok := shard.buckets[bucket("a", "foo")]; ok {
+			assert.NotContains(t, nonces.byName, "foo")
+		}
+	})
+
+	t.Run("ClientQuota", func(t *testing.T) {
+		rs := newReplayStore()
+
+		// fill the quota of one bucket with tokens issued a minute ago
+		issued := now.Add(-time.Minute)
+		old := nonces("a", "old", replayClientQuota+2)
+		for _, nonce := range old[:replayClientQuota] {
+			assert.True(t, rs.add("a", newUsed(nonce, issued), now))
+		}
+
+		assert.True(t, rs.add("a", newUsed(old[replayClientQuota], now), now))
+
+		shard := rs.shard("a")
+		assert.Equal(t, replayClientQuota, shard.size)
+		assert.NotContains(t, shard.buckets[bucket("a", "old")].byName, old[0])
+
+		// the evicted nonce cannot be replayed, nor can other tokens of the bucket issued at the same time
+		assert.False(t, rs.add("a", newUsed(old[0], issued), now))
+		assert.False(t, rs.add("a", newUsed(old[replayClientQuota+1], issued), now))
+	})
+
+	t.Run("SharedClient", func(t *testing.T) {
+		rs := newReplayStore()
+
+		// someone behind the same IP address uses up the quota of their bucket
+		issued := now.Add(-time.Minute)
+		for _, nonce := range nonces("a", "flood", replayClientQuota+1) {
+			assert.True(t, rs.add("a", newUsed(nonce, issued), now))
+		}
+
+		// which does not reject pending tokens of others in different buckets
+		pending := 0
+		for i := 0; i < replayClientBuckets; i++ {
+			nonce := fmt.Sprintf("pending%d", i)
+			if bucket("a", nonce) != bucket("a", "flood") {
+				assert.True(t, rs.add("a", newUsed(nonce, issued), now))
+				pending++
+			}
+		}
+		assert.NotZero(t, pending)
+	})
+
+	t.Run("ShardCapacity", func(t *testing.T) {
+		rs := newReplayStore()
+
+		// find many clients sharing one shard with a legitimate user
+		shard := rs.shard("legit")
+		var flooders []string
+		for i := 0; len(flooders)*replayClientQuota < replayShardCapacity; i++ {
+			name := fmt.Sprintf("flooder%d", i)
+			if rs.shard(name) == shard {
+				flooders = append(flooders, name)
+			}
+		}
+
+		assert.True(t, rs.add("legit", newUsed("legit", now), now))
+
+		for _, flooder := range flooders {
+			for i := 0; i < replayClientQuota; i++ {
+				assert.True(t, rs.add(flooder, newUsed(fmt.Sprintf("%s-%d", flooder, i), now), now))
+			}
+		}
+
+		assert.True(t, shard.size <= replayShardCapacity)
+		assert.False(t, rs.add("legit", newUsed("legit", now), now))
+	})
+}
+
+// testFlood checks that legitimate users can redeem their tokens once while others flood
+// store with redeemed and wrong answers, count times each
+func testFlood(t *testing.T, store ReplayStore, count int) {
+
+	bs := NewBotStopper(nil)
+	bs.SetReplayStore(store)
+
+	// legitimate users fetch their challenges before and during the flood
+	legitCount := 100
+	legit := make([]Challenge, legitCount)
+	for i := range legit {
+		legit[i] = bs.GetChallenge(Request{Client: fmt.Sprintf("legit%d", i)})
+	}
+
+	// one client floods with challenges and correct answers, another with wrong answers
+	var wg sync.WaitGroup
+	for _, flooder := range []string{"flooder", "wrong"} {
+		wg.Add(1)
+		go func(flooder string) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				challenge := bs.GetChallenge(Request{Client: flooder})
+				answer := "wrong"
+				if flooder == "flooder" {
+					answer = answerQuestion(t, challenge.Question)
+				}
+				bs.Verify(Response{ID: challenge.ID, Answer: answer, Client: flooder})
+			}
+		}(flooder)
+	}
+	wg.Wait()
+
+	for i, challenge := range legit {
+		client := fmt.Sprintf("legit%d", i)
+		response := Response{
+			ID:     challenge.ID,
+			Answer: answerQuestion(t, challenge.Question),
+			Client: client,
+		}
+		assert.True(t, bs.Verify(response))
+
+		// and their tokens still cannot be replayed
+		assert.False(t, bs.Verify(response))
+	}
+}
+
+func TestBotStopperFlood(t *testing.T) {
+	testFlood(t, newReplayStore(), 2*maxUsedNonces)
+}
+
+func TestSQLStore(t *testing.T) {
+
+	db := testdb.Open(t)
+	defer db.Close()
+
+	assert.Nil(t, Migrate(db))
+
+	// clean up before and after this test
+	cleanup := func() {
+		_, err := db.Exec("TRUNCATE botstopper_redeemed_token, botstopper_watermark")
+		assert.Nil(t, err)
+	}
+	cleanup()
+	defer cleanup()
+
+	now := time.Now()
+	token := RedeemedToken{Nonce: "foo", IssuedAt: now, ExpiresAt: now.Add(answerExpiry)}
+
+	t.Run("Redeem", func(t *testing.T) {
+		store := NewSQLStore(db)
+
+		fresh, err := store.Redeem("a", token, now)
+		assert.Nil(t, err)
+		assert.True(t, fresh)
+
+		fresh, err = store.Redeem("a", token, now)
+		assert.Nil(t, err)
+		assert.False(t, fresh)
+
+		// another replica, or the same server after a restart
+		fresh, err = NewSQLStore(db).Redeem("a", token, now)
+		assert.Nil(t, err)
+		assert.False(t, fresh)
+
+		fresh, err = store.Redeem("b", token, now)
+		assert.Nil(t, err)
+		assert.True(t, fresh)
+	})
+
+	t.Run("PruneExpired", func(t *testing.T) {
+		later := now.Add(2 * answerExpiry)
+
+		fresh, err := NewSQLStore(db).Redeem("a", RedeemedToken{Nonce: "bar", IssuedAt: later, ExpiresAt: later.Add(answerExpiry)}, later)
+		assert.Nil(t, err)
+		assert.True(t, fresh)
+
+		var count int
+		assert.Nil(t, db.QueryRow("SELECT count(*) FROM botstopper_redeemed_token").Scan(&count))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("ClientQuota", func(t *testing.T) {
+		store := NewSQLStore(db)
+
+		// fill the quota of one bucket with tokens issued a minute ago
+		issued := now.Add(-time.Minute)
+		old := nonces("quota", "old", replayClientQuota+2)
+		for _, nonce := range old[:replayClientQuota] {
+			fresh, err := store.Redeem("quota", RedeemedToken{Nonce: nonce, IssuedAt: issued, ExpiresAt: issued.Add(answerExpiry)}, now)
+			assert.Nil(t, err)
+			assert.True(t, fresh)
+		}
+
+		fresh, err := store.Redeem("quota", RedeemedToken{Nonce: old[replayClientQuota], IssuedAt: now, ExpiresAt: now.Add(answerExpiry)}, now)
+		assert.Nil(t, err)
+		assert.True(t, fresh)
+
+		var count int
+		assert.Nil(t, db.QueryRow("SELECT count(*) FROM botstopper_redeemed_token WHERE client = 'quota'").Scan(&count))
+		assert.Equal(t, replayClientQuota, count)
+
+		// the evicted tokens cannot be replayed, nor can other tokens of the bucket issued at the same time
+		for _, nonce := range []string{old[0], old[replayClientQuota+1]} {
+			fresh, err = store.Redeem("quota", RedeemedToken{Nonce: nonce, IssuedAt: issued, ExpiresAt: issued.Add(answerExpiry)}, now)
+			assert.Nil(t, err)
+			assert.False(t, fresh)
+		}
+
+		// tokens of other buckets are not affected
+		for i := 0; ; i++ {
+			nonce := fmt.Sprintf("other%d", i)
+			if bucketIndex(nonce) != bucketIndex("old") {
+				fresh, err = store.Redeem("quota", RedeemedToken{Nonce: nonce, IssuedAt: issued, ExpiresAt: issued.Add(answerExpiry)}, now)
+				assert.Nil(t, err)
+				assert.True(t, fresh)
+				break
+			}
+		}
+	})
+
+	t.Run("Flood", func(t *testing.T) {
+		testFlood(t, NewSQLStore(db), 2*replayClientQuota*replayClientBuckets)
+
+		// the flooder only fills its own quota
+		var count int
+		assert.Nil(t, db.QueryRow("SELECT count(*) FROM botstopper_redeemed_token WHERE client = 'flooder'").Scan(&count))
+		assert.True(t, count <= replayClientQuota*replayClientBuckets)
+	})
+
+	t.Run("BotStopper", func(t *testing.T) {
+		secret := []byte("secret")
+
+		replicas := []*BotStopper{NewBotStopper(secret), NewBotStopper(secret)}
+		for _, replica := range replicas {
+			replica.SetReplayStore(NewSQLStore(db))
+		}
+
+		challenge := replicas[0].GetChallenge(Request{Client: "a"})
+		response := Response{ID: challenge.ID, Answer: answerQuestion(t, challenge.Question), Client: "a"}
+
+		assert.True(t, replicas[0].Verify(response))
+		assert.False(t, replicas[1].Verify(response))
+	})
+}
@@ -0,0 +1,190 @@
+package botstopper
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	nonceBytes     = 16
+	secretBytes    = 32
+	maxUsedNonces  = 10000
+	tokenSeparator = "."
+)
+
+var (
+	errTokenMalformed = errors.New("challenge token is malformed")
+	errTokenSignature = errors.New("challenge token has an invalid signature")
+	errTokenExpired   = errors.New("challenge token has expired")
+	errTokenUsed      = errors.New("challenge token was used before")
+	errTokenClient    = errors.New("challenge token was issued to another client")
+
+	encoding = base64.RawURLEncoding
+)
+
+// randomNonce returns a random URL-safe string
+func randomNonce() string {
+	nonce := make([]byte, nonceBytes)
+	if _, err := rand.Read(nonce); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return encoding.EncodeToString(nonce)
+}
+
+// randomInt returns a uniformly distributed integer in [0, n)
+func randomInt(n int) int {
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return int(value.Int64())
+}
+
+// NewSecret returns a random secret for signing challenges
+func NewSecret() []byte {
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return secret
+}
+
+// tokenPayload is the signed content of a challenge ID
+type tokenPayload struct {
+	Nonce      string `json:"n"`
+	IssuedAt   int64  `json:"i"`
+	ExpiresAt  int64  `json:"e"`
+	Difficulty int    `json:"d,omitempty"`
+
+	// Client is who the token was issued to, only they can redeem it
+	Client string `json:"c"`
+
+	// AnswerMACs bind the accepted answers to the token without revealing them
+	AnswerMACs []string `json:"a,omitempty"`
+}
+
+// signer creates and checks HMAC-signed challenge tokens, so no state is needed between
+// issuing and verifying a challenge, even across restarts and replicas sharing the secret
+type signer struct {
+	secret []byte
+	used   ReplayStore
+}
+
+func newSigner(secret []byte) *signer {
+
+	if len(secret) == 0 {
+		secret = NewSecret()
+	}
+
+	return &signer{
+		secret: secret,
+		used:   newReplayStore(),
+	}
+}
+
+func (s *signer) mac(parts ...string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join(parts, "\x00")))
+	return mac.Sum(nil)
+}
+
+// answerMAC binds an answer to a nonce
+func (s *signer) answerMAC(nonce, answer string) string {
+	return encoding.EncodeToString(s.mac("answer", nonce, answer))
+}
+
+// sign encodes a payload as token
+func (s *signer) sign(payload tokenPayload) string {
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		panic("encoding challenge token failed: " + err.Error())
+	}
+
+	encoded := encoding.EncodeToString(payloadBytes)
+	signature := encoding.EncodeToString(s.mac("token", encoded))
+
+	return encoded + tokenSeparator + signature
+}
+
+// open checks the signature and expiry of a token and returns its payload
+func (s *signer) open(token string, now time.Time) (*tokenPayload, error) {
+
+	parts := strings.Split(token, tokenSeparator)
+	if len(parts) != 2 {
+		return nil, errTokenMalformed
+	}
+
+	signature, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errTokenMalformed
+	}
+
+	if !hmac.Equal(signature, s.mac("token", parts[0])) {
+		return nil, errTokenSignature
+	}
+
+	payloadBytes, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errTokenMalformed
+	}
+
+	var payload tokenPayload
+	if err = json.Unmarshal(payloadBytes, &payload); err != nil {
+		return nil, errTokenMalformed
+	}
+
+	if !now.Before(time.Unix(payload.ExpiresAt, 0)) {
+		return nil, errTokenExpired
+	}
+
+	return &payload, nil
+}
+
+// redeem opens a token issued to client and marks it as used, so it can be verified only once
+func (s *signer) redeem(token, client string, now time.Time) (*tokenPayload, error) {
+
+	payload, err := s.open(token, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.Client != client {
+		return nil, errTokenClient
+	}
+
+	redeemed := RedeemedToken{
+		Nonce:     payload.Nonce,
+		IssuedAt:  time.Unix(payload.IssuedAt, 0),
+		ExpiresAt: time.Unix(payload.ExpiresAt, 0),
+	}
+
+	fresh, err := s.used.Redeem(client, redeemed, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fresh {
+		return nil, errTokenUsed
+	}
+
+	return payload, nil
+}
+
+// issuedAt returns when a valid token was issued, without redeeming it
+func (s *signer) issuedAt(token string, now time.Time) (time.Time, error) {
+
+	payload, err := s.open(token, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(payload.IssuedAt, 0), nil
+}
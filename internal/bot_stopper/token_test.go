@@ -0,0 +1,69 @@
+package botstopper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignerOpen(t *testing.T) {
+
+	s := newSigner(nil)
+	now := time.Now()
+
+	payload := tokenPayload{
+		Nonce:     randomNonce(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+	token := s.sign(payload)
+
+	type testCase struct {
+		name          string
+		token         string
+		now           time.Time
+		expectedError error
+	}
+
+	testCases := []testCase{
+		testCase{"OK", token, now, nil},
+		testCase{"Expired", token, now.Add(2 * time.Minute), errTokenExpired},
+		testCase{"Empty", "", now, errTokenMalformed},
+		testCase{"NoSeparator", "foo", now, errTokenMalformed},
+		testCase{"BadEncoding", token + "!", now, errTokenMalformed},
+		testCase{"BadSignature", token[:len(token)-2] + "AA", now, errTokenSignature},
+		testCase{"OtherSecret", newSigner(nil).sign(payload), now, errTokenSignature},
+	}
+
+	for _, testCase := range testCases {
+		opened, err := s.open(testCase.token, testCase.now)
+		assert.Equalf(t, testCase.expectedError, err, "case=%s", testCase.name)
+		if err == nil {
+			assert.Equalf(t, payload, *opened, "case=%s", testCase.name)
+		}
+	}
+}
+
+func TestSignerRedeem(t *testing.T) {
+
+	s := newSigner(nil)
+	now := time.Now()
+
+	payload := tokenPayload{
+		Nonce:     randomNonce(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		Client:    "1.2.3.4",
+	}
+	token := s.sign(payload)
+
+	_, err := s.redeem(token, "5.6.7.8", now)
+	assert.Equal(t, errTokenClient, err)
+
+	_, err = s.redeem(token, "1.2.3.4", now)
+	assert.Nil(t, err)
+
+	_, err = s.redeem(token, "1.2.3.4", now)
+	assert.Equal(t, errTokenUsed, err)
+}
@@ -0,0 +1,187 @@
+package botscore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const pruneInterval = time.Minute
+
+var errInvalidThreshold = errors.New("bot score threshold should be a positive number or off")
+
+// Config sets the weight of every signal, a submission scoring Threshold or more is rejected
+type Config struct {
+	Threshold float64
+
+	// HoneypotScore is added when the hidden honeypot field is filled in
+	HoneypotScore float64
+
+	// TooFastScore is added when a challenge is answered within MinAnswerTime of issuing it
+	TooFastScore  float64
+	MinAnswerTime time.Duration
+
+	// FailureScore is added for every rejected submission of the client within FailureWindow
+	FailureScore  float64
+	FailureWindow time.Duration
+}
+
+// DefaultConfig rejects honeypot hits right away and other signals only when combined
+var DefaultConfig = Config{
+	Threshold:     1,
+	HoneypotScore: 1,
+	TooFastScore:  0.6,
+	MinAnswerTime: 3 * time.Second,
+	FailureScore:  0.2,
+	FailureWindow: 10 * time.Minute,
+}
+
+// ParseThreshold parses a threshold like "1.5". An empty string means the default threshold,
+// "off" disables scoring, for which nil is returned.
+func ParseThreshold(value string) (*float64, error) {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		threshold := DefaultConfig.Threshold
+		return &threshold, nil
+	}
+
+	if value == "off" {
+		return nil, nil
+	}
+
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold <= 0 {
+		return nil, errInvalidThreshold
+	}
+
+	return &threshold, nil
+}
+
+// Signals are what is known about a submission
+type Signals struct {
+	// Client identifies the user, usually by IP address
+	Client string
+
+	// Honeypot is the value of a form field humans can't see
+	Honeypot string
+
+	// AnswerTime is how long the user took to answer the challenge
+	AnswerTime time.Duration
+}
+
+// Verdict is the outcome of scoring a submission
+type Verdict struct {
+	Score    float64
+	Rejected bool
+
+	// Reasons explains what added to the score
+	Reasons []string
+}
+
+// Scorer combines bot signals into a score and remembers recent failures per client
+type Scorer struct {
+	config Config
+
+	mutex     sync.Mutex
+	failures  map[string][]time.Time
+	lastPrune time.Time
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewScorer returns a Scorer for config
+func NewScorer(config Config) *Scorer {
+	return &Scorer{
+		config:    config,
+		failures:  make(map[string][]time.Time),
+		lastPrune: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// recent drops failures outside the window and returns the ones left
+func (s *Scorer) recent(client string, now time.Time) []time.Time {
+
+	failures := s.failures[client]
+
+	i := 0
+	for i < len(failures) && now.Sub(failures[i]) > s.config.FailureWindow {
+		i++
+	}
+
+	failures = failures[i:]
+	if len(failures) == 0 {
+		delete(s.failures, client)
+	} else {
+		s.failures[client] = failures
+	}
+
+	return failures
+}
+
+// prune forgets clients without recent failures
+func (s *Scorer) prune(now time.Time) {
+	for client := range s.failures {
+		s.recent(client, now)
+	}
+	s.lastPrune = now
+}
+
+// Evaluate scores a submission, rejected submissions count as failure of the client
+func (s *Scorer) Evaluate(signals Signals) Verdict {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+
+	if now.Sub(s.lastPrune) > pruneInterval {
+		s.prune(now)
+	}
+
+	verdict := Verdict{}
+
+	add := func(score float64, reason string) {
+		verdict.Score += score
+		verdict.Reasons = append(verdict.Reasons, reason)
+	}
+
+	if signals.Honeypot != "" {
+		add(s.config.HoneypotScore, "honeypot field filled in")
+	}
+
+	if signals.AnswerTime < s.config.MinAnswerTime {
+		add(s.config.TooFastScore, fmt.Sprintf("challenge answered in %s", signals.AnswerTime))
+	}
+
+	if count := len(s.recent(signals.Client, now)); count > 0 {
+		add(float64(count)*s.config.FailureScore, fmt.Sprintf("%d recent failures", count))
+	}
+
+	verdict.Rejected = verdict.Score >= s.config.Threshold
+	if verdict.Rejected {
+		s.failures[signals.Client] = append(s.failures[signals.Client], now)
+	}
+
+	return verdict
+}
+
+// RecordFailure counts a failure of client that was detected elsewhere, like a wrong answer
+func (s *Scorer) RecordFailure(client string) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.failures[client] = append(s.recent(client, now), now)
+}
+
+// String formats a verdict for logging
+func (v Verdict) String() string {
+	return fmt.Sprintf("score %.2f: %s", v.Score, strings.Join(v.Reasons, ", "))
+}
@@ -0,0 +1,127 @@
+package botscore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThreshold(t *testing.T) {
+
+	one := 1.0
+	half := 0.5
+
+	type testCase struct {
+		value             string
+		expectedThreshold *float64
+		expectedError     error
+	}
+
+	testCases := []testCase{
+		testCase{"", &one, nil},
+		testCase{"off", nil, nil},
+		testCase{"0.5", &half, nil},
+		testCase{" 1 ", &one, nil},
+		testCase{"0", nil, errInvalidThreshold},
+		testCase{"-1", nil, errInvalidThreshold},
+		testCase{"high", nil, errInvalidThreshold},
+	}
+
+	for _, testCase := range testCases {
+		threshold, err := ParseThreshold(testCase.value)
+		assert.Equalf(t, testCase.expectedThreshold, threshold, "value=%s", testCase.value)
+		assert.Equalf(t, testCase.expectedError, err, "value=%s", testCase.value)
+	}
+}
+
+// fakeClock lets tests control the time seen by a Scorer
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func newTestScorer() (*Scorer, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	s := NewScorer(DefaultConfig)
+	s.now = clock.Now
+	return s, clock
+}
+
+func TestScorerEvaluate(t *testing.T) {
+
+	human := Signals{Client: "1.2.3.4", AnswerTime: 10 * time.Second}
+
+	t.Run("Human", func(t *testing.T) {
+		s, _ := newTestScorer()
+		verdict := s.Evaluate(human)
+		assert.Equal(t, Verdict{}, verdict)
+	})
+
+	t.Run("Honeypot", func(t *testing.T) {
+		s, _ := newTestScorer()
+		signals := human
+		signals.Honeypot = "http://spam.example.com"
+
+		verdict := s.Evaluate(signals)
+		assert.True(t, verdict.Rejected)
+		assert.Equal(t, []string{"honeypot field filled in"}, verdict.Reasons)
+	})
+
+	t.Run("TooFastAlone", func(t *testing.T) {
+		s, _ := newTestScorer()
+		signals := human
+		signals.AnswerTime = time.Second
+
+		verdict := s.Evaluate(signals)
+		assert.False(t, verdict.Rejected)
+		assert.Equal(t, 0.6, verdict.Score)
+		assert.Equal(t, []string{"challenge answered in 1s"}, verdict.Reasons)
+	})
+
+	t.Run("TooFastAfterFailures", func(t *testing.T) {
+		s, _ := newTestScorer()
+		s.RecordFailure(human.Client)
+		s.RecordFailure(human.Client)
+
+		// failures of other clients don't count
+		s.RecordFailure("5.6.7.8")
+
+		signals := human
+		signals.AnswerTime = time.Second
+
+		verdict := s.Evaluate(signals)
+		assert.True(t, verdict.Rejected)
+		assert.Equal(t, []string{"challenge answered in 1s", "2 recent failures"}, verdict.Reasons)
+		assert.Equal(t, "score 1.00: challenge answered in 1s, 2 recent failures", verdict.String())
+	})
+
+	t.Run("RepeatedFailures", func(t *testing.T) {
+		s, _ := newTestScorer()
+		for i := 0; i < 4; i++ {
+			s.RecordFailure(human.Client)
+		}
+		assert.False(t, s.Evaluate(human).Rejected)
+
+		s.RecordFailure(human.Client)
+		assert.True(t, s.Evaluate(human).Rejected)
+
+		// the rejection itself counts as failure too
+		assert.Equal(t, 6, len(s.failures[human.Client]))
+	})
+
+	t.Run("FailuresExpire", func(t *testing.T) {
+		s, clock := newTestScorer()
+		for i := 0; i < 5; i++ {
+			s.RecordFailure(human.Client)
+		}
+		assert.True(t, s.Evaluate(human).Rejected)
+
+		clock.now = clock.now.Add(DefaultConfig.FailureWindow + time.Second)
+		assert.False(t, s.Evaluate(human).Rejected)
+		assert.Empty(t, s.failures)
+	})
+}
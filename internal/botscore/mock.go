@@ -0,0 +1,28 @@
+package botscore
+
+import "github.com/stretchr/testify/mock"
+
+// Interface is the external interface of the Scorer
+type Interface interface {
+	Evaluate(signals Signals) Verdict
+	RecordFailure(client string)
+}
+
+var _ Interface = (*Scorer)(nil)
+var _ Interface = (*MockScorer)(nil)
+
+// MockScorer is a struct for external testing
+type MockScorer struct {
+	mock.Mock
+}
+
+// Evaluate mocks scoring a submission
+func (ms *MockScorer) Evaluate(signals Signals) Verdict {
+	args := ms.Called(signals)
+	return args.Get(0).(Verdict)
+}
+
+// RecordFailure mocks counting a failure
+func (ms *MockScorer) RecordFailure(client string) {
+	ms.Called(client)
+}
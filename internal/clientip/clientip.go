@@ -0,0 +1,118 @@
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const contextKey = "client_ip"
+
+// Extractor determines the IP address of clients, proxy headers are only honoured from trusted peers
+type Extractor struct {
+	trusted []*net.IPNet
+}
+
+// NewExtractor returns an Extractor trusting the listed IP addresses and CIDR ranges
+func NewExtractor(trusted []string) (*Extractor, error) {
+
+	ex := &Extractor{}
+
+	for _, entry := range trusted {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		ex.trusted = append(ex.trusted, network)
+	}
+
+	return ex, nil
+}
+
+func (ex *Extractor) isTrusted(ip net.IP) bool {
+
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range ex.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// Extract returns the IP address of the client that sent req
+func (ex *Extractor) Extract(req *http.Request) string {
+
+	peer := remoteIP(req)
+
+	if !ex.isTrusted(net.ParseIP(peer)) {
+		return peer
+	}
+
+	// walk X-Forwarded-For from the right, the first untrusted hop is the client
+	if forwarded := req.Header.Get(echo.HeaderXForwardedFor); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			ip := net.ParseIP(hop)
+			if ip == nil {
+				break
+			}
+			if !ex.isTrusted(ip) {
+				return ip.String()
+			}
+		}
+	}
+
+	if realIP := net.ParseIP(req.Header.Get(echo.HeaderXRealIP)); realIP != nil {
+		return realIP.String()
+	}
+
+	return peer
+}
+
+// Middleware stores the client IP of every request in its context
+func (ex *Extractor) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(contextKey, ex.Extract(c.Request()))
+			return next(c)
+		}
+	}
+}
+
+// Get returns the client IP stored by the middleware, without it only the peer address is used
+func Get(c echo.Context) string {
+
+	if ip, ok := c.Get(contextKey).(string); ok {
+		return ip
+	}
+
+	return remoteIP(c.Request())
+}
@@ -0,0 +1,94 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewExtractor(t *testing.T) {
+
+	t.Run("OK", func(t *testing.T) {
+		ex, err := NewExtractor([]string{"10.0.0.0/8", " 127.0.0.1 ", "::1", ""})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(ex.trusted))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewExtractor([]string{"foo"})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestExtractorExtract(t *testing.T) {
+
+	ex, err := NewExtractor([]string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+
+	type testCase struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		expectedIP   string
+	}
+
+	testCases := []testCase{
+		testCase{"Direct", "1.2.3.4:1234", "", "", "1.2.3.4"},
+		testCase{"UntrustedPeerHeadersIgnored", "1.2.3.4:1234", "5.6.7.8", "5.6.7.8", "1.2.3.4"},
+		testCase{"TrustedPeerRealIP", "10.0.0.1:1234", "", "5.6.7.8", "5.6.7.8"},
+		testCase{"TrustedPeerForwardedFor", "10.0.0.1:1234", "5.6.7.8", "", "5.6.7.8"},
+		testCase{"SpoofedForwardedFor", "10.0.0.1:1234", "6.6.6.6, 5.6.7.8", "", "5.6.7.8"},
+		testCase{"ProxyChain", "10.0.0.1:1234", "5.6.7.8, 10.0.0.2", "", "5.6.7.8"},
+		testCase{"InvalidHeaders", "10.0.0.1:1234", "garbage", "garbage", "10.0.0.1"},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = testCase.remoteAddr
+		if testCase.forwardedFor != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, testCase.forwardedFor)
+		}
+		if testCase.realIP != "" {
+			req.Header.Set(echo.HeaderXRealIP, testCase.realIP)
+		}
+
+		assert.Equalf(t, testCase.expectedIP, ex.Extract(req), "case=%s", testCase.name)
+	}
+}
+
+func TestGet(t *testing.T) {
+
+	ex, err := NewExtractor([]string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+
+	e := echo.New()
+
+	t.Run("WithoutMiddleware", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(echo.HeaderXRealIP, "5.6.7.8")
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		assert.Equal(t, "10.0.0.1", Get(c))
+	})
+
+	t.Run("WithMiddleware", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(echo.HeaderXRealIP, "5.6.7.8")
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		var got string
+		handler := ex.Middleware()(func(c echo.Context) error {
+			got = Get(c)
+			return nil
+		})
+
+		assert.Nil(t, handler(c))
+		assert.Equal(t, "5.6.7.8", got)
+	})
+}
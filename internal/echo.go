@@ -1,16 +1,33 @@
 package internal
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"html/template"
+	"io/fs"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/lk16/heyluuk/internal/assets"
+	"github.com/lk16/heyluuk/internal/auth"
+	"github.com/lk16/heyluuk/internal/blocklist"
 	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+	"github.com/lk16/heyluuk/internal/botscore"
+	"github.com/lk16/heyluuk/internal/clientip"
+	"github.com/lk16/heyluuk/internal/health"
+	"github.com/lk16/heyluuk/internal/logging"
+	"github.com/lk16/heyluuk/internal/metrics"
+	"github.com/lk16/heyluuk/internal/openapi"
+	"github.com/lk16/heyluuk/internal/predictions"
+	"github.com/lk16/heyluuk/internal/ratelimit"
 	"github.com/lk16/heyluuk/internal/redirect"
+	"github.com/lk16/heyluuk/web"
+	"github.com/sirupsen/logrus"
 
 	_ "github.com/jinzhu/gorm/dialects/postgres" // db driver
 )
@@ -21,54 +38,349 @@ var (
 	postgresUser     = os.Getenv("POSTGRES_USER")
 	postgresPassword = os.Getenv("POSTGRES_PASSWORD")
 	postgresHost     = "db"
+	adminToken       = os.Getenv("ADMIN_TOKEN")
+	apiKeys          = os.Getenv("API_KEYS")
+	signingKey       = os.Getenv("PREDICTION_SIGNING_KEY")
+	escrowKey        = os.Getenv("PREDICTION_ESCROW_KEY")
+	blocklistFile    = os.Getenv("BLOCKLIST_FILE")
+	allowedSchemes   = os.Getenv("ALLOWED_URL_SCHEMES")
+	trustedProxies   = os.Getenv("TRUSTED_PROXIES")
+	botStopperMode   = os.Getenv("BOTSTOPPER_MODE")
+	botStopperSecret = os.Getenv("BOTSTOPPER_SECRET")
+	logFormat        = os.Getenv("LOG_FORMAT")
+	logLevel         = os.Getenv("LOG_LEVEL")
+	questionsDir     = os.Getenv("BOTSTOPPER_QUESTIONS")
+	webDir           = os.Getenv("WEB_DIR")
+	templateReload   = os.Getenv("TEMPLATE_RELOAD")
+
+	// publicURL is the address of the site, it should stay the same across hosts and proxies
+	publicURL = getEnv("PUBLIC_URL", "https://heylu.uk")
+
+	// metricsAddress is not proxied by nginx, so metrics are only reachable from the internal network
+	metricsAddress = getEnv("METRICS_ADDRESS", ":9090")
 )
 
-// GetServer returns a configured server
-func GetServer() *echo.Echo {
+const (
+	blocklistPollInterval = 5 * time.Second
+
+	// revealInterval is how often escrowed predictions are checked for being due
+	revealInterval = time.Minute
+)
+
+// getEnv returns the value of an environment variable or fallback when it is not set
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// rateLimit returns middleware enforcing the limit configured in an environment variable
+func rateLimit(key, fallback string) []echo.MiddlewareFunc {
+
+	limit, err := ratelimit.ParseLimit(getEnv(key, fallback))
+	if err != nil {
+		logrus.Fatalf("%s: %s", key, err.Error())
+	}
+
+	if limit == nil {
+		return nil
+	}
+
+	return []echo.MiddlewareFunc{ratelimit.NewLimiter(*limit).Middleware()}
+}
+
+// newBotStopper returns the anti-bot implementation selected by BOTSTOPPER_MODE,
+// redeemed challenges are remembered in store
+func newBotStopper(store botstopper.ReplayStore) botstopper.Interface {
+
+	if botStopperSecret == "" {
+		logrus.Warn("BOTSTOPPER_SECRET is not set, challenges will not survive a restart")
+	}
+
+	secret := []byte(botStopperSecret)
+
+	switch botStopperMode {
+	case "", botstopper.KindArithmetic:
+		sources := []botstopper.Source{botstopper.Arithmetic{}}
+		if questionsDir != "" {
+			banks, err := botstopper.LoadQuestionBanks(questionsDir)
+			if err != nil {
+				logrus.Fatalf("BOTSTOPPER_QUESTIONS: %s", err.Error())
+			}
+			sources = append(sources, banks)
+		}
+		bs := botstopper.NewBotStopper(secret, sources...)
+		bs.SetReplayStore(store)
+		return bs
+	case botstopper.KindProofOfWork:
+		pow := botstopper.NewProofOfWork(botstopper.DefaultProofOfWorkConfig, secret)
+		pow.SetReplayStore(store)
+		return pow
+	default:
+		logrus.Fatalf("BOTSTOPPER_MODE: unknown mode %s", botStopperMode)
+		return nil
+	}
+}
+
+// newBotScorer returns a scorer with the threshold configured in BOTSCORE_THRESHOLD
+func newBotScorer() botscore.Interface {
+
+	threshold, err := botscore.ParseThreshold(os.Getenv("BOTSCORE_THRESHOLD"))
+	if err != nil {
+		logrus.Fatalf("BOTSCORE_THRESHOLD: %s", err.Error())
+	}
+
+	if threshold == nil {
+		return nil
+	}
 
-	dsn := fmt.Sprintf("host=%s sslmode=disable user=%s password=%s dbname=%s", postgresHost,
+	config := botscore.DefaultConfig
+	config.Threshold = *threshold
+	return botscore.NewScorer(config)
+}
+
+// postgresDSN returns the connection string of the database
+func postgresDSN() string {
+	return fmt.Sprintf("host=%s sslmode=disable user=%s password=%s dbname=%s", postgresHost,
 		postgresUser, postgresPassword, postgresDB)
+}
 
-	db, err := gorm.Open("postgres", dsn)
+// GetServer returns a configured server
+func GetServer() *Server {
+
+	logger := logrus.StandardLogger()
+	if err := logging.Configure(logger, os.Stdout, logFormat, logLevel); err != nil {
+		logger.Fatalf("LOG_FORMAT or LOG_LEVEL: %s", err.Error())
+	}
+
+	db, err := openDB(postgresDSN())
 	if err != nil {
-		log.Fatal(err.Error())
+		logrus.WithError(err).Fatal("connecting to database failed")
 	}
 
-	if err := redirect.Migrate(db); err != nil {
-		panic("Redirect DB migration failed: " + err.Error())
+	metrics.RegisterDBCallbacks(db)
+
+	if err := migrateUp(context.Background(), db.DB()); err != nil {
+		logrus.WithError(err).Fatal("migrating database failed")
+	}
+
+	extractor, err := clientip.NewExtractor(strings.Split(trustedProxies, ","))
+	if err != nil {
+		logrus.Fatalf("TRUSTED_PROXIES: %s", err.Error())
 	}
 
 	e := echo.New()
-	e.Use(middleware.Logger())
+	server := &Server{Echo: e}
+	server.addCloser(db)
+
+	e.HideBanner = true
+	e.HidePort = true
+	e.Use(extractor.Middleware())
+	e.Use(metrics.Middleware())
+	e.Use(middleware.RequestID())
+	e.Use(logging.Middleware(logger, isProbe))
 	e.Use(middleware.Recover())
-	e.Renderer = NewTemplateRenderer()
+
+	files := web.FS(webDir)
+	templatesFS, err := fs.Sub(files, "templates")
+	if err != nil {
+		logrus.WithError(err).Fatal("loading templates failed")
+	}
+
+	staticFS, err := fs.Sub(files, "static")
+	if err != nil {
+		logrus.WithError(err).Fatal("loading static files failed")
+	}
+
+	static, err := assets.New(staticFS)
+	if err != nil {
+		logrus.WithError(err).Fatal("hashing static files failed")
+	}
+
+	// files on disk may be edited while serving
+	static.Live = webDir != ""
+
+	renderer, err := NewTemplateRenderer(logger, templatesFS, template.FuncMap{"static": static.URL}, pages)
+	if err != nil {
+		logrus.WithError(err).Fatal("parsing templates failed")
+	}
+
+	if templateReload != "" {
+		if renderer.Reload, err = strconv.ParseBool(templateReload); err != nil {
+			logrus.Fatalf("TEMPLATE_RELOAD: %s", err.Error())
+		}
+	}
+
+	renderer.User = currentUser(adminToken)
+	e.Renderer = renderer
+
+	if metricsAddress != "" {
+		server.addCloser(startMetrics(metricsAddress))
+	}
+
+	checker := &health.Checker{}
+	checker.Add("db", func(ctx context.Context) error {
+		return db.DB().PingContext(ctx)
+	})
+	checker.Add("migrations", func(ctx context.Context) error {
+		return checkMigrations(ctx, db.DB())
+	})
+	checker.Add("templates", renderer.Check)
+
+	botStopper := metrics.BotStopper{Interface: newBotStopper(botstopper.NewSQLStore(db.DB()))}
 
 	controller := &redirect.Controller{
 		DB:         db,
-		BotStopper: botstopper.NewBotStopper(),
+		BotStopper: botStopper,
+		BotScorer:  newBotScorer(),
+		Logger:     logger,
+		AdminToken: adminToken,
+	}
+
+	predictionsController := &predictions.Controller{
+		DB:         db,
+		BotStopper: botStopper,
+		Logger:     logger,
+		AdminToken: adminToken,
+	}
+
+	if apiKeys != "" {
+		controller.APIKeys = strings.Split(apiKeys, ",")
+	}
+
+	if signingKey == "" {
+		logrus.Warn("PREDICTION_SIGNING_KEY is not set, predictions will not be countersigned")
+	} else {
+		key, err := predictions.ParseSigningKey(signingKey)
+		if err != nil {
+			logrus.Fatalf("PREDICTION_SIGNING_KEY: %s", err.Error())
+		}
+		predictionsController.SigningKey = key
+	}
+
+	if escrowKey != "" {
+		key, err := predictions.ParseEscrowKey(escrowKey)
+		if err != nil {
+			logrus.Fatalf("PREDICTION_ESCROW_KEY: %s", err.Error())
+		}
+		predictionsController.EscrowKey = key
+
+		revealer, err := predictions.NewRevealer(predictionsController)
+		if err != nil {
+			logrus.WithError(err).Fatal("starting revealer failed")
+		}
+		revealer.Start(revealInterval)
+		server.addCloser(revealer)
+	}
+
+	if publicURL != "" {
+		if predictionsController.PublicURL, err = predictions.ParsePublicURL(publicURL); err != nil {
+			logrus.Fatalf("PUBLIC_URL: %s", err.Error())
+		}
+	}
+
+	controller.AllowedSchemes = urlSchemes()
+
+	if blocklistFile != "" {
+		bl, err := blocklist.New(blocklistFile)
+		if err != nil {
+			logrus.WithField("file", blocklistFile).WithError(err).Fatal("loading blocklist failed")
+		}
+		bl.Watch(blocklistPollInterval)
+		server.addCloser(bl)
+		controller.Blocklist = bl
 	}
 
-	e.Static("/static", "./web/static")
-	e.Static("/static/jquery", "/npm/node_modules/jquery/dist")
-	e.Static("/static/bootstrap", "/npm/node_modules/bootstrap/dist")
-	e.Static("/static/patternfly-bootstrap-treeview", "/npm/node_modules/patternfly-bootstrap-treeview/dist")
-	e.Static("/static/font-awesome", "/npm/node_modules/@fortawesome/fontawesome-free")
+	e.GET(assets.Prefix+"*", static.Handler())
 
 	e.GET("/", redirectView("/at/my/site"))
-	e.GET("/at/my/site", renderTemplateView("index.html"))
-	e.GET("/at/my/faq", renderTemplateView("faq.html"))
-	e.GET("/at/my/predictions", renderTemplateView("predictions.html"))
-	e.GET("/at/my/terms", renderTemplateView("terms_and_conditions.html"))
-	e.GET("/at/my/links", renderTemplateView("new_link.html"))
+	e.GET("/at/my/predictions/feed.atom", predictionsController.Feed)
+
+	registerPages(e, pages, map[string]echo.HandlerFunc{
+		"predictions.html": predictionsController.Page,
+	})
+
+	RegisterAPIRoutes(e, controller, predictionsController)
+
+	e.GET("/healthz", checker.Healthz)
+	e.GET("/readyz", checker.Readyz)
 
-	e.POST("/api/link", controller.PostLink)
+	e.GET("/*", controller.Redirect, rateLimit("RATE_LIMIT_REDIRECT", "120/m")...)
+	return server
+}
+
+// currentUser returns "admin" for requests carrying the admin token as bearer token,
+// and nothing for anonymous visitors
+func currentUser(adminToken string) func(c echo.Context) string {
+	return func(c echo.Context) string {
+		if auth.IsAdmin(c, adminToken) {
+			return "admin"
+		}
+		return ""
+	}
+}
+
+// newMetricsServer returns a server for the Prometheus metrics only
+func newMetricsServer() *echo.Echo {
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.GET("/metrics", metrics.Handler())
+
+	return e
+}
+
+// startMetrics serves the metrics on their own address, they expose route, outcome and
+// database timings which are not meant for visitors
+func startMetrics(address string) *echo.Echo {
+
+	e := newMetricsServer()
+
+	go func() {
+		logrus.WithField("address", address).Info("starting metrics server")
+		if err := e.Start(address); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Error("metrics server stopped")
+		}
+	}()
+
+	return e
+}
+
+// RegisterAPIRoutes adds all /api and /.well-known routes of the controllers, every one of them must be documented in the OpenAPI spec
+func RegisterAPIRoutes(e *echo.Echo, controller *redirect.Controller, predictionsController *predictions.Controller) {
+
+	challengeLimit := rateLimit("RATE_LIMIT_CHALLENGE", "30/m")
+	linkLimit := rateLimit("RATE_LIMIT_LINK", "10/m")
+	predictionLimit := rateLimit("RATE_LIMIT_PREDICTION", "10/m")
+
+	e.POST("/api/link", controller.PostLink, linkLimit...)
+	e.GET("/api/link/by-url", controller.GetLinkByURL)
+	e.GET("/api/link/history", controller.GetLinkHistory)
+	e.POST("/api/link/rollback", controller.PostLinkRollback, linkLimit...)
 	e.GET("/api/node/:id", controller.GetNode)
 	e.GET("/api/node/:id/children", controller.GetNodeChildren)
 	e.GET("/api/node/root", controller.GetNodeRoot)
-	e.GET("/api/challenge", controller.GetChallenge)
+	e.GET("/api/challenge", controller.GetChallenge, challengeLimit...)
+	e.POST("/api/prediction", predictionsController.PostPrediction, predictionLimit...)
+	e.GET("/api/prediction", predictionsController.GetPredictions)
+	e.GET("/api/prediction/:id", predictionsController.GetPrediction)
+	e.POST("/api/prediction/:id/reveal", predictionsController.RevealPrediction, predictionLimit...)
+	e.POST("/api/prediction/verify", predictionsController.VerifyPrediction)
+	e.GET("/api/prediction/:id/proof", predictionsController.GetProof)
+	e.GET("/api/prediction/log", predictionsController.GetLog)
+	e.GET("/api/prediction/log/head", predictionsController.GetLogHead)
+	e.POST("/api/prediction/:id/outcome", predictionsController.ResolvePrediction)
+	e.GET("/api/prediction/stats", predictionsController.GetStats)
+	e.POST("/api/prediction/key", predictionsController.PostAuthorKey)
+	e.GET("/.well-known/prediction-keys.json", predictionsController.GetKeys)
+	e.GET("/api/openapi.json", openapi.Handler())
+}
 
-	e.GET("/*", controller.Redirect)
-	return e
+// isProbe returns true for health check requests, which are too frequent to log
+func isProbe(c echo.Context) bool {
+	return c.Path() == "/healthz" || c.Path() == "/readyz"
 }
 
 func redirectView(URL string) func(c echo.Context) error {
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/openapi"
+	"github.com/lk16/heyluuk/internal/predictions"
+	"github.com/lk16/heyluuk/internal/redirect"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIRoutesDocumented(t *testing.T) {
+
+	document, err := openapi.Spec()
+	assert.Nil(t, err)
+
+	e := echo.New()
+	RegisterAPIRoutes(e, &redirect.Controller{}, &predictions.Controller{})
+
+	registered := make(map[string]bool)
+
+	for _, route := range e.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") && !strings.HasPrefix(route.Path, "/.well-known/") {
+			continue
+		}
+
+		registered[openapi.Path(route.Path)] = true
+		assert.True(t, document.Documented(route.Method, route.Path),
+			"%s %s is not documented in internal/openapi/openapi.json", route.Method, route.Path)
+	}
+
+	for path := range document.Paths {
+		assert.True(t, registered[path], "%s is documented but has no route", path)
+	}
+}
+
+func TestMetricsServer(t *testing.T) {
+
+	e := newMetricsServer()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "promhttp_metric_handler_requests_total")
+
+	// it serves nothing but the metrics
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/link/history", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCurrentUser(t *testing.T) {
+
+	user := currentUser("secret")
+
+	c, _ := testContext()
+	assert.Equal(t, "", user(c))
+
+	c.Request().Header.Set(echo.HeaderAuthorization, "Bearer secret")
+	assert.Equal(t, "admin", user(c))
+
+	c.Request().Header.Set(echo.HeaderAuthorization, "Bearer wrong")
+	assert.Equal(t, "", user(c))
+}
@@ -0,0 +1,95 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+
+	// CheckTimeout limits how long all readiness checks together may take
+	CheckTimeout = 2 * time.Second
+)
+
+// Check returns an error when a dependency of the app is not ready
+type Check func(ctx context.Context) error
+
+// Response is returned by the health endpoints
+type Response struct {
+	Status string `json:"status"`
+
+	// Checks has the outcome of every readiness check by name, either "ok" or an error
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs readiness checks
+type Checker struct {
+	checks []namedCheck
+}
+
+// Add registers a readiness check under name
+func (ch *Checker) Add(name string, check Check) {
+	ch.checks = append(ch.checks, namedCheck{name: name, check: check})
+}
+
+// Run executes all checks concurrently and returns whether all passed
+func (ch *Checker) Run(ctx context.Context) (bool, map[string]string) {
+
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	results := make([]string, len(ch.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range ch.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			if err := check(ctx); err != nil {
+				results[i] = err.Error()
+			} else {
+				results[i] = statusOK
+			}
+		}(i, check.check)
+	}
+	wg.Wait()
+
+	ready := true
+	outcomes := make(map[string]string, len(ch.checks))
+	for i, check := range ch.checks {
+		outcomes[check.name] = results[i]
+		if results[i] != statusOK {
+			ready = false
+		}
+	}
+
+	return ready, outcomes
+}
+
+// Healthz reports that the process is alive
+func (ch *Checker) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, Response{Status: statusOK})
+}
+
+// Readyz reports whether the app can serve requests, with the outcome of every check
+func (ch *Checker) Readyz(c echo.Context) error {
+
+	ready, outcomes := ch.Run(c.Request().Context())
+
+	if !ready {
+		return c.JSON(http.StatusServiceUnavailable, Response{Status: statusUnavailable, Checks: outcomes})
+	}
+
+	return c.JSON(http.StatusOK, Response{Status: statusOK, Checks: outcomes})
+}
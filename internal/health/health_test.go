@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+
+	e := echo.New()
+
+	ok := func(ctx context.Context) error {
+		return nil
+	}
+
+	tester := func(t *testing.T, handler echo.HandlerFunc, expectedStatusCode int, expectedResponse Response) {
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := handler(c)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedStatusCode, rec.Code)
+
+		var response Response
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, expectedResponse, response)
+	}
+
+	t.Run("Healthz", func(t *testing.T) {
+		checker := &Checker{}
+		checker.Add("db", func(ctx context.Context) error {
+			return errors.New("not called")
+		})
+
+		// liveness does not depend on the readiness checks
+		tester(t, checker.Healthz, http.StatusOK, Response{Status: "ok"})
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		checker := &Checker{}
+		checker.Add("db", ok)
+		checker.Add("templates", ok)
+
+		expected := Response{Status: "ok", Checks: map[string]string{"db": "ok", "templates": "ok"}}
+		tester(t, checker.Readyz, http.StatusOK, expected)
+	})
+
+	t.Run("NotReady", func(t *testing.T) {
+		checker := &Checker{}
+		checker.Add("db", func(ctx context.Context) error {
+			return errors.New("connection refused")
+		})
+		checker.Add("templates", ok)
+
+		expected := Response{Status: "unavailable",
+			Checks: map[string]string{"db": "connection refused", "templates": "ok"}}
+		tester(t, checker.Readyz, http.StatusServiceUnavailable, expected)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		checker := &Checker{}
+		checker.Add("db", func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Minute):
+				return nil
+			}
+		})
+
+		start := time.Now()
+		ready, outcomes := checker.Run(context.Background())
+
+		assert.False(t, ready)
+		assert.Equal(t, context.DeadlineExceeded.Error(), outcomes["db"])
+		assert.True(t, time.Since(start) < time.Minute)
+	})
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/lk16/heyluuk/internal/clientip"
+	"github.com/sirupsen/logrus"
+)
+
+// Field names shared by all log lines
+const (
+	FieldRequestID    = "request_id"
+	FieldPath         = "path"
+	FieldNodeID       = "node_id"
+	FieldPredictionID = "prediction_id"
+	FieldClientIP     = "client_ip"
+)
+
+const (
+	// FormatJSON writes one JSON object per line, for production
+	FormatJSON = "json"
+
+	// FormatConsole writes human readable lines, for development
+	FormatConsole = "console"
+)
+
+var errInvalidFormat = errors.New("log format should be json or console")
+
+// Configure sets up logger to write in format at level, empty values mean json and info
+func Configure(logger *logrus.Logger, out io.Writer, format, level string) error {
+
+	logger.SetOutput(out)
+
+	switch strings.TrimSpace(format) {
+	case "", FormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	case FormatConsole:
+		logger.SetFormatter(&logrus.TextFormatter{ForceColors: true, FullTimestamp: true})
+	default:
+		return errInvalidFormat
+	}
+
+	if strings.TrimSpace(level) == "" {
+		level = logrus.InfoLevel.String()
+	}
+
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	logger.SetLevel(parsed)
+	return nil
+}
+
+// Request returns an entry with the fields identifying the request of c
+func Request(logger logrus.FieldLogger, c echo.Context) *logrus.Entry {
+
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	return logger.WithFields(logrus.Fields{
+		FieldRequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+		FieldPath:      c.Request().URL.Path,
+	})
+}
+
+// Middleware logs every request after it is handled, except when skipper returns true.
+// It should run after the request ID middleware.
+func Middleware(logger logrus.FieldLogger, skipper middleware.Skipper) echo.MiddlewareFunc {
+
+	if skipper == nil {
+		skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			if skipper(c) {
+				return next(c)
+			}
+
+			start := time.Now()
+
+			err := next(c)
+			if err != nil {
+				// write the error response now so the status is known, echo won't write it again
+				c.Error(err)
+			}
+
+			entry := Request(logger, c).WithFields(logrus.Fields{
+				"method":      c.Request().Method,
+				"route":       c.Path(),
+				"status":      c.Response().Status,
+				"latency_ms":  float64(time.Since(start).Microseconds()) / 1000,
+				"bytes_out":   c.Response().Size,
+				"user_agent":  c.Request().UserAgent(),
+				FieldClientIP: clientip.Get(c),
+			})
+
+			if err != nil {
+				entry = entry.WithError(err)
+			}
+
+			switch status := c.Response().Status; {
+			case status >= 500:
+				entry.Error("request failed")
+			case status >= 400:
+				entry.Warn("request rejected")
+			default:
+				entry.Info("request handled")
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigure(t *testing.T) {
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := logrus.New()
+
+		assert.Nil(t, Configure(logger, &out, "", ""))
+		assert.Equal(t, logrus.InfoLevel, logger.GetLevel())
+
+		logger.WithField(FieldNodeID, 3).Info("hello")
+
+		var line map[string]interface{}
+		assert.Nil(t, json.Unmarshal(out.Bytes(), &line))
+		assert.Equal(t, "hello", line["msg"])
+		assert.Equal(t, float64(3), line[FieldNodeID])
+	})
+
+	t.Run("Console", func(t *testing.T) {
+		var out bytes.Buffer
+		logger := logrus.New()
+
+		assert.Nil(t, Configure(logger, &out, FormatConsole, "debug"))
+		assert.Equal(t, logrus.DebugLevel, logger.GetLevel())
+
+		logger.Debug("hello")
+		assert.True(t, strings.Contains(out.String(), "hello"))
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		err := Configure(logrus.New(), &bytes.Buffer{}, "xml", "")
+		assert.Equal(t, errInvalidFormat, err)
+	})
+
+	t.Run("InvalidLevel", func(t *testing.T) {
+		err := Configure(logrus.New(), &bytes.Buffer{}, "", "loud")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+
+	logger, hook := test.NewNullLogger()
+
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(Middleware(logger, func(c echo.Context) bool {
+		return c.Path() == "/healthz"
+	}))
+
+	e.GET("/api/node/:id", func(c echo.Context) error {
+		Request(logger, c).WithField(FieldNodeID, c.Param("id")).Info("handler")
+		return c.NoContent(http.StatusOK)
+	})
+
+	e.GET("/broken", func(c echo.Context) error {
+		return errors.New("dummy error")
+	})
+
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		hook.Reset()
+
+		req := httptest.NewRequest(http.MethodGet, "/api/node/3", nil)
+		req.Header.Set(echo.HeaderXRequestID, "abc")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, "abc", rec.Header().Get(echo.HeaderXRequestID))
+
+		entries := hook.AllEntries()
+		assert.Equal(t, 2, len(entries))
+
+		// the handler and access log lines share the request fields
+		for _, entry := range entries {
+			assert.Equal(t, "abc", entry.Data[FieldRequestID])
+			assert.Equal(t, "/api/node/3", entry.Data[FieldPath])
+		}
+
+		assert.Equal(t, "3", entries[0].Data[FieldNodeID])
+
+		access := entries[1]
+		assert.Equal(t, logrus.InfoLevel, access.Level)
+		assert.Equal(t, "/api/node/:id", access.Data["route"])
+		assert.Equal(t, http.StatusOK, access.Data["status"])
+	})
+
+	t.Run("GeneratedRequestID", func(t *testing.T) {
+		hook.Reset()
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/node/3", nil))
+
+		requestID := rec.Header().Get(echo.HeaderXRequestID)
+		assert.NotEmpty(t, requestID)
+		assert.Equal(t, requestID, hook.LastEntry().Data[FieldRequestID])
+	})
+
+	t.Run("Skipped", func(t *testing.T) {
+		hook.Reset()
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, hook.AllEntries())
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		hook.Reset()
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/broken", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		entry := hook.LastEntry()
+		assert.Equal(t, logrus.ErrorLevel, entry.Level)
+		assert.Equal(t, http.StatusInternalServerError, entry.Data["status"])
+		assert.Equal(t, "dummy error", entry.Data[logrus.ErrorKey].(error).Error())
+	})
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+
+// BotStopper counts issued challenges and verification results of the wrapped implementation
+type BotStopper struct {
+	botstopper.Interface
+}
+
+var _ botstopper.Interface = BotStopper{}
+
+// GetChallenge generates a new challenge
+func (bs BotStopper) GetChallenge(request botstopper.Request) botstopper.Challenge {
+	challenge := bs.Interface.GetChallenge(request)
+	ChallengesIssued.WithLabelValues(challenge.Kind).Inc()
+	return challenge
+}
+
+// Verify checks the answer of a challenge
+func (bs BotStopper) Verify(response botstopper.Response) bool {
+	ok := bs.Interface.Verify(response)
+	if ok {
+		ChallengeVerifications.WithLabelValues("success").Inc()
+	} else {
+		ChallengeVerifications.WithLabelValues("failure").Inc()
+	}
+	return ok
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const startKey = "metrics:start"
+
+// startTimer remembers when a query started
+func startTimer(scope *gorm.Scope) {
+	scope.Set(startKey, time.Now())
+}
+
+// observeQuery returns a callback recording the latency of a query as operation
+func observeQuery(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		if start, ok := scope.Get(startKey); ok {
+			DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start.(time.Time)).Seconds())
+		}
+	}
+}
+
+// RegisterDBCallbacks makes db record the latency of all its queries
+func RegisterDBCallbacks(db *gorm.DB) {
+
+	callback := db.Callback()
+
+	// only the SQL statements are timed, not the hooks and transactions around them
+	callback.Create().Before("gorm:create").Register("metrics:start_create", startTimer)
+	callback.Create().After("gorm:create").Register("metrics:observe_create", observeQuery("create"))
+
+	callback.Query().Before("gorm:query").Register("metrics:start_query", startTimer)
+	callback.Query().After("gorm:query").Register("metrics:observe_query", observeQuery("query"))
+
+	callback.Update().Before("gorm:update").Register("metrics:start_update", startTimer)
+	callback.Update().After("gorm:update").Register("metrics:observe_update", observeQuery("update"))
+
+	callback.Delete().Before("gorm:delete").Register("metrics:start_delete", startTimer)
+	callback.Delete().After("gorm:delete").Register("metrics:observe_delete", observeQuery("delete"))
+
+	callback.RowQuery().Before("gorm:row_query").Register("metrics:start_row_query", startTimer)
+	callback.RowQuery().After("gorm:row_query").Register("metrics:observe_row_query", observeQuery("row_query"))
+}
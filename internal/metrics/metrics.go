@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace      = "heyluuk"
+	unmatchedRoute = "unmatched"
+)
+
+var (
+	// Requests counts handled requests per route pattern
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Handled HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// RequestDuration measures request latency per route pattern
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// Redirects counts shortcut lookups by result
+	Redirects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Shortcut lookups by result: hit, not_found, invalid, blocked or error.",
+	}, []string{"result"})
+
+	// LinkCreations counts PostLink requests by outcome
+	LinkCreations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "link_creations_total",
+		Help:      "Link creation requests by outcome.",
+	}, []string{"outcome"})
+
+	// ChallengesIssued counts anti-bot challenges by kind
+	ChallengesIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "challenges_issued_total",
+		Help:      "Issued anti-bot challenges by kind.",
+	}, []string{"kind"})
+
+	// ChallengeVerifications counts checked challenge answers by result
+	ChallengeVerifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "challenge_verifications_total",
+		Help:      "Verified anti-bot challenge answers by result: success or failure.",
+	}, []string{"result"})
+
+	// DBQueryDuration measures database latency per operation
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation"})
+)
+
+// Middleware records count and latency of every request, labeled with the route pattern
+// rather than the actual path, so shortcuts don't create a time series each
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				if httpErr, ok := err.(*echo.HTTPError); ok {
+					status = httpErr.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+
+			method := c.Request().Method
+			route := c.Path()
+
+			// echo sets the actual path when no route matches, which should not become a label
+			if err == echo.ErrNotFound || err == echo.ErrMethodNotAllowed {
+				route = unmatchedRoute
+			}
+
+			Requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			RequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
+
+// Handler serves all metrics in the Prometheus text format
+func Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
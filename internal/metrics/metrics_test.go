@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMiddleware(t *testing.T) {
+
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/api/node/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/metrics", Handler())
+
+	ok := Requests.WithLabelValues(http.MethodGet, "/api/node/:id", "200")
+	notFound := Requests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")
+	okBefore := testutil.ToFloat64(ok)
+	notFoundBefore := testutil.ToFloat64(notFound)
+
+	for _, path := range []string{"/api/node/1", "/api/node/2", "/unknown"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// requests are counted by route, not by path
+	assert.Equal(t, okBefore+2, testutil.ToFloat64(ok))
+	assert.Equal(t, notFoundBefore+1, testutil.ToFloat64(notFound))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(),
+		`heyluuk_http_request_duration_seconds_count{method="GET",route="/api/node/:id"}`))
+}
+
+func TestBotStopper(t *testing.T) {
+
+	var verifier botstopper.MockVerifier
+	verifier.On("GetChallenge", mock.Anything).Return(botstopper.Challenge{Kind: botstopper.KindArithmetic})
+	verifier.On("Verify", botstopper.Response{Answer: "right"}).Return(true)
+	verifier.On("Verify", botstopper.Response{Answer: "wrong"}).Return(false)
+
+	bs := BotStopper{Interface: &verifier}
+
+	issued := ChallengesIssued.WithLabelValues(botstopper.KindArithmetic)
+	success := ChallengeVerifications.WithLabelValues("success")
+	failure := ChallengeVerifications.WithLabelValues("failure")
+
+	issuedBefore := testutil.ToFloat64(issued)
+	successBefore := testutil.ToFloat64(success)
+	failureBefore := testutil.ToFloat64(failure)
+
+	challenge := bs.GetChallenge(botstopper.Request{})
+	assert.Equal(t, botstopper.KindArithmetic, challenge.Kind)
+
+	assert.True(t, bs.Verify(botstopper.Response{Answer: "right"}))
+	assert.False(t, bs.Verify(botstopper.Response{Answer: "wrong"}))
+	assert.False(t, bs.Verify(botstopper.Response{Answer: "wrong"}))
+
+	assert.Equal(t, issuedBefore+1, testutil.ToFloat64(issued))
+	assert.Equal(t, successBefore+1, testutil.ToFloat64(success))
+	assert.Equal(t, failureBefore+2, testutil.ToFloat64(failure))
+}
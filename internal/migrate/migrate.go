@@ -0,0 +1,315 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockKey identifies the advisory lock held while migrating, it is "heyluuk" in ASCII
+const lockKey int64 = 0x6865796c75756b
+
+var (
+	errDuplicateVersion = errors.New("duplicate migration version")
+	errMissingDirection = errors.New("migration needs both an up and a down file")
+	errUnknownVersion   = errors.New("applied migration has no migration file")
+
+	// fileRegex matches migration file names like 0001_create_tables.up.sql
+	fileRegex = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+)
+
+// Migration changes the schema from the previous version to Version and back
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load reads all migrations in dir of fsys, sorted by version. Every migration consists of
+// two files named like 0001_create_tables.up.sql and 0001_create_tables.down.sql.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, entry := range entries {
+
+		match := fileRegex.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%s: invalid version", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), errDuplicateVersion)
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("%04d_%s: %w", migration.Version, migration.Name, errMissingDirection)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies the migrations of one component, like a package owning some tables.
+// Applied versions are stored per component in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	component  string
+	migrations []Migration
+}
+
+// New returns a Migrator for the migrations of component
+func New(db *sql.DB, component string, migrations []Migration) *Migrator {
+	return &Migrator{
+		db:         db,
+		component:  component,
+		migrations: migrations,
+	}
+}
+
+// Component returns the name of the component this Migrator is for
+func (m *Migrator) Component() string {
+	return m.component
+}
+
+// querier is implemented by both sql.DB and sql.Conn
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// applied returns when every applied version of this component was applied
+func (m *Migrator) applied(ctx context.Context, q querier) (map[int]time.Time, error) {
+
+	var exists bool
+	err := q.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx,
+		`SELECT version, applied_at FROM schema_migrations WHERE component = $1`, m.component)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// Status returns all migrations and whether they have been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses[i] = Status{Migration: migration, Applied: ok, AppliedAt: appliedAt}
+	}
+
+	return statuses, nil
+}
+
+// withLock runs f on a connection holding the migration lock,
+// so replicas starting at the same time don't migrate concurrently
+func (m *Migrator) withLock(ctx context.Context, f func(conn *sql.Conn) error) error {
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		component text NOT NULL,
+		version integer NOT NULL,
+		name text NOT NULL,
+		applied_at timestamp with time zone NOT NULL DEFAULT now(),
+		PRIMARY KEY (component, version)
+	)`)
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+// run executes a migration and updates schema_migrations in one transaction
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	statement := migration.Down
+	if up {
+		statement = migration.Up
+	}
+
+	if _, err = tx.ExecContext(ctx, statement); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%s migration %04d_%s: %w", m.component, migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (component, version, name) VALUES ($1, $2, $3)`,
+			m.component, migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE component = $1 AND version = $2`,
+			m.component, migration.Version)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Up applies all pending migrations in order and returns the ones it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if err = m.run(ctx, conn, migration, true); err != nil {
+				return err
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the last steps applied migrations and returns the ones it rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		byVersion := make(map[int]Migration, len(m.migrations))
+		for _, migration := range m.migrations {
+			byVersion[migration.Version] = migration
+		}
+
+		for _, version := range versions {
+			migration, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("%s version %d: %w", m.component, version, errUnknownVersion)
+			}
+
+			if err = m.run(ctx, conn, migration, false); err != nil {
+				return err
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
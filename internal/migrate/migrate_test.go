@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lk16/heyluuk/internal/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content)}
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/0002_add_index.up.sql":      file("CREATE INDEX"),
+			"migrations/0002_add_index.down.sql":    file("DROP INDEX"),
+			"migrations/0001_create_table.up.sql":   file("CREATE TABLE"),
+			"migrations/0001_create_table.down.sql": file("DROP TABLE"),
+			"migrations/README.md":                  file("ignored"),
+		}
+
+		migrations, err := Load(fsys, "migrations")
+		assert.Nil(t, err)
+
+		expected := []Migration{
+			{Version: 1, Name: "create_table", Up: "CREATE TABLE", Down: "DROP TABLE"},
+			{Version: 2, Name: "add_index", Up: "CREATE INDEX", Down: "DROP INDEX"},
+		}
+		assert.Equal(t, expected, migrations)
+	})
+
+	t.Run("MissingDown", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/0001_create_table.up.sql": file("CREATE TABLE"),
+		}
+
+		_, err := Load(fsys, "migrations")
+		assert.True(t, errors.Is(err, errMissingDirection))
+	})
+
+	t.Run("DuplicateVersion", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/0001_create_table.up.sql":   file("CREATE TABLE"),
+			"migrations/0001_create_table.down.sql": file("DROP TABLE"),
+			"migrations/0001_other.up.sql":          file("CREATE INDEX"),
+			"migrations/0001_other.down.sql":        file("DROP INDEX"),
+		}
+
+		_, err := Load(fsys, "migrations")
+		assert.True(t, errors.Is(err, errDuplicateVersion))
+	})
+
+	t.Run("MissingDir", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{}, "migrations")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestMigrator(t *testing.T) {
+
+	db := testdb.Open(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	migrations := []Migration{
+		{Version: 1, Name: "create_table", Up: "CREATE TABLE migrate_test (id integer)", Down: "DROP TABLE migrate_test"},
+		{Version: 2, Name: "add_column", Up: "ALTER TABLE migrate_test ADD COLUMN name text", Down: "ALTER TABLE migrate_test DROP COLUMN name"},
+	}
+
+	migrator := New(db, "migrate_test", migrations)
+
+	// clean up after this test finishes
+	defer func() {
+		db.Exec("DROP TABLE IF EXISTS migrate_test")
+		db.Exec("DELETE FROM schema_migrations WHERE component = 'migrate_test'")
+	}()
+
+	applied, err := migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, migrations, applied)
+
+	// nothing is pending anymore
+	applied, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := migrator.Status(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(statuses))
+	assert.True(t, statuses[0].Applied && statuses[1].Applied)
+
+	_, err = db.Exec("INSERT INTO migrate_test (id, name) VALUES (1, 'foo')")
+	assert.Nil(t, err)
+
+	rolledBack, err := migrator.Down(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, migrations[1:], rolledBack)
+
+	statuses, err = migrator.Status(ctx)
+	assert.Nil(t, err)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+
+	t.Run("FailingMigrationRollsBack", func(t *testing.T) {
+		broken := append(migrations[:1:1], Migration{Version: 2, Name: "broken",
+			Up: "ALTER TABLE migrate_test ADD COLUMN other text; SELECT * FROM missing_table", Down: ""})
+
+		_, err := New(db, "migrate_test", broken).Up(ctx)
+		assert.NotNil(t, err)
+
+		// the column of the failed migration was not added
+		_, err = db.Exec("SELECT other FROM migrate_test")
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+	"github.com/lk16/heyluuk/internal/migrate"
+	"github.com/lk16/heyluuk/internal/predictions"
+	"github.com/lk16/heyluuk/internal/redirect"
+	"github.com/sirupsen/logrus"
+)
+
+const migrateUsage = `usage: heyluuk migrate status
+       heyluuk migrate up
+       heyluuk migrate down <component> [steps]
+
+Rolling back the first migration of a component drops its tables with all their data.
+The redirect and predictions components refuse to do so, their tables have to be
+dropped by hand.`
+
+var (
+	errMigrateUsage     = errors.New(migrateUsage)
+	errUnknownComponent = errors.New("unknown migration component")
+	errPendingMigration = errors.New("database has pending migrations")
+)
+
+// migrators returns a Migrator for every component with versioned migrations
+func migrators(db *sql.DB) ([]*migrate.Migrator, error) {
+
+	redirectMigrator, err := redirect.NewMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+
+	predictionsMigrator, err := predictions.NewMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+
+	botStopperMigrator, err := botstopper.NewMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*migrate.Migrator{redirectMigrator, predictionsMigrator, botStopperMigrator}, nil
+}
+
+// migrateUp applies the pending migrations of all components
+func migrateUp(ctx context.Context, db *sql.DB) error {
+
+	all, err := migrators(db)
+	if err != nil {
+		return err
+	}
+
+	for _, migrator := range all {
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			logrus.WithFields(logrus.Fields{
+				"component": migrator.Component(),
+				"version":   migration.Version,
+				"name":      migration.Name,
+			}).Info("applied migration")
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkMigrations is a readiness check returning an error when migrations are pending
+func checkMigrations(ctx context.Context, db *sql.DB) error {
+
+	all, err := migrators(db)
+	if err != nil {
+		return err
+	}
+
+	for _, migrator := range all {
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if !status.Applied {
+				return errPendingMigration
+			}
+		}
+	}
+
+	return nil
+}
+
+// printStatus writes a table with all migrations to out
+func printStatus(ctx context.Context, all []*migrate.Migrator, out io.Writer) error {
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "COMPONENT\tVERSION\tNAME\tAPPLIED")
+
+	for _, migrator := range all {
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%04d\t%s\t%s\n", migrator.Component(), status.Version, status.Name, applied)
+		}
+	}
+
+	return w.Flush()
+}
+
+// migrateDown rolls back the last migrations of the component named in args
+func migrateDown(ctx context.Context, all []*migrate.Migrator, args []string, out io.Writer) error {
+
+	if len(args) < 1 || len(args) > 2 {
+		return errMigrateUsage
+	}
+
+	steps := 1
+	if len(args) == 2 {
+		var err error
+		if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+			return errMigrateUsage
+		}
+	}
+
+	for _, migrator := range all {
+		if migrator.Component() != args[0] {
+			continue
+		}
+
+		rolledBack, err := migrator.Down(ctx, steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(out, "rolled back %s %04d_%s\n", migrator.Component(), migration.Version, migration.Name)
+		}
+		return err
+	}
+
+	return fmt.Errorf("%s: %w", args[0], errUnknownComponent)
+}
+
+// RunMigrate runs the migrate command with args, like "status", "up" or "down redirect 1"
+func RunMigrate(args []string, out io.Writer) error {
+
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	db, err := openDB(postgresDSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	all, err := migrators(db.DB())
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		return printStatus(ctx, all, out)
+	case "up":
+		if err = migrateUp(ctx, db.DB()); err != nil {
+			return err
+		}
+		return printStatus(ctx, all, out)
+	case "down":
+		return migrateDown(ctx, all, args[1:], out)
+	default:
+		return errMigrateUsage
+	}
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateDownArguments(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, args := range [][]string{{}, {"redirect", "0"}, {"redirect", "x"}, {"redirect", "1", "2"}} {
+		err := migrateDown(ctx, nil, args, &bytes.Buffer{})
+		assert.Equal(t, errMigrateUsage, err, args)
+	}
+
+	err := migrateDown(ctx, nil, []string{"unknown"}, &bytes.Buffer{})
+	assert.True(t, errors.Is(err, errUnknownComponent))
+}
+
+func TestRunMigrateUsage(t *testing.T) {
+	assert.Equal(t, errMigrateUsage, RunMigrate(nil, &bytes.Buffer{}))
+}
+
+func TestMigrators(t *testing.T) {
+
+	// loading the embedded migration files does not need a database
+	all, err := migrators(nil)
+	assert.Nil(t, err)
+
+	var components []string
+	for _, migrator := range all {
+		components = append(components, migrator.Component())
+	}
+	assert.Equal(t, []string{"redirect", "predictions", "botstopper"}, components)
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lk16/heyluuk/internal/redirect"
+)
+
+const normalizeLinksUsage = `usage: heyluuk normalize-links
+
+Normalizes the destinations of links created before destination URLs were normalized,
+so looking up shortcuts by URL finds them. Every change is recorded in the link history.`
+
+var errNormalizeLinksUsage = errors.New(normalizeLinksUsage)
+
+// urlSchemes returns the destination URL schemes configured in ALLOWED_URL_SCHEMES,
+// nil means the defaults of the redirect package
+func urlSchemes() []string {
+	if allowedSchemes == "" {
+		return nil
+	}
+	return strings.Split(allowedSchemes, ",")
+}
+
+// RunNormalizeLinks runs the normalize-links command, it is safe to run more than once
+func RunNormalizeLinks(args []string, out io.Writer) error {
+
+	if len(args) != 0 {
+		return errNormalizeLinksUsage
+	}
+
+	db, err := openDB(postgresDSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	updated, skipped, err := redirect.NormalizeLinks(db, urlSchemes())
+	fmt.Fprintf(out, "normalized %d links, skipped %d links with invalid URLs\n", updated, skipped)
+	return err
+}
@@ -0,0 +1,12 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunNormalizeLinksUsage(t *testing.T) {
+	assert.Equal(t, errNormalizeLinksUsage, RunNormalizeLinks([]string{"now"}, &bytes.Buffer{}))
+}
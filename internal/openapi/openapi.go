@@ -0,0 +1,64 @@
+package openapi
+
+import (
+	_ "embed" // embedding the spec
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Document is the part of an OpenAPI document needed to check it against the code
+type Document struct {
+	// Paths maps every path to its operations by lowercase HTTP method
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+
+	Components struct {
+		Schemas map[string]Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// Schema is a JSON schema, limited to what is needed to compare it with a Go type
+type Schema struct {
+	Type       string            `json:"type"`
+	Properties map[string]Schema `json:"properties"`
+	Required   []string          `json:"required"`
+}
+
+// Spec parses the embedded OpenAPI document
+func Spec() (*Document, error) {
+	var document Document
+	if err := json.Unmarshal(spec, &document); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// Documented returns whether the document has an operation for method on an echo route path
+// like /api/node/:id, which is written as /api/node/{id} in OpenAPI
+func (d *Document) Documented(method, path string) bool {
+	_, ok := d.Paths[Path(path)][strings.ToLower(method)]
+	return ok
+}
+
+// Path converts an echo route path to an OpenAPI path
+func Path(echoPath string) string {
+	segments := strings.Split(echoPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Handler serves the OpenAPI document
+func Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, spec)
+	}
+}
@@ -0,0 +1,126 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+	"github.com/lk16/heyluuk/internal/predictions"
+	"github.com/lk16/heyluuk/internal/redirect"
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonFields returns the JSON field names of a struct type, including those of embedded structs
+func jsonFields(t reflect.Type) []string {
+
+	var fields []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+
+	return fields
+}
+
+func TestSchemasMatchModels(t *testing.T) {
+
+	document, err := Spec()
+	assert.Nil(t, err)
+
+	models := map[string]interface{}{
+		"ErrorResponse":            redirect.ErrorResponse{},
+		"Node":                     redirect.Node{},
+		"Revision":                 redirect.Revision{},
+		"PostLinkBody":             redirect.PostLinkBody{},
+		"CreateLinkResponse":       redirect.CreateLinkResponse{},
+		"LinkByURLResponse":        redirect.LinkByURLResponse{},
+		"RollbackLinkBody":         redirect.RollbackLinkBody{},
+		"Challenge":                botstopper.Challenge{},
+		"Prediction":               predictions.Prediction{},
+		"PostPredictionBody":       predictions.PostPredictionBody{},
+		"RevealPredictionBody":     predictions.RevealPredictionBody{},
+		"VerifyPredictionBody":     predictions.VerifyPredictionBody{},
+		"VerifyPredictionResponse": predictions.VerifyPredictionResponse{},
+		"LogEntry":                 predictions.LogEntry{},
+		"Head":                     predictions.Head{},
+		"InclusionProof":           predictions.InclusionProof{},
+		"ResolvePredictionBody":    predictions.ResolvePredictionBody{},
+		"CalibrationBucket":        predictions.CalibrationBucket{},
+		"Stats":                    predictions.Stats{},
+		"PeriodStats":              predictions.PeriodStats{},
+		"StatsResponse":            predictions.StatsResponse{},
+		"AuthorKey":                predictions.AuthorKey{},
+		"PostAuthorKeyBody":        predictions.PostAuthorKeyBody{},
+		"KeysResponse":             predictions.KeysResponse{},
+	}
+
+	for name, model := range models {
+		t.Run(name, func(t *testing.T) {
+			schema, ok := document.Components.Schemas[name]
+			assert.True(t, ok)
+
+			var properties []string
+			for property := range schema.Properties {
+				properties = append(properties, property)
+			}
+
+			expected := jsonFields(reflect.TypeOf(model))
+			sort.Strings(expected)
+			sort.Strings(properties)
+			assert.Equal(t, expected, properties)
+
+			for _, required := range schema.Required {
+				assert.Contains(t, properties, required)
+			}
+		})
+	}
+
+	assert.Equal(t, len(models), len(document.Components.Schemas))
+}
+
+func TestDocumented(t *testing.T) {
+
+	document, err := Spec()
+	assert.Nil(t, err)
+
+	assert.True(t, document.Documented(http.MethodGet, "/api/node/:id/children"))
+	assert.True(t, document.Documented(http.MethodPost, "/api/link"))
+	assert.False(t, document.Documented(http.MethodDelete, "/api/link"))
+	assert.False(t, document.Documented(http.MethodGet, "/api/unknown"))
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/api/node/{id}/children", Path("/api/node/:id/children"))
+	assert.Equal(t, "/api/node/root", Path("/api/node/root"))
+}
+
+func TestHandler(t *testing.T) {
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil), rec)
+
+	assert.Nil(t, Handler()(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, spec, rec.Body.Bytes())
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// Page is a page of the site, it drives both the route and the sidebar
+type Page struct {
+	Path string
+
+	// Template renders the page, pages without one are served elsewhere like the dots game behind nginx
+	Template string
+
+	// Title is shown in the browser tab, after the name of the site
+	Title string
+
+	// Nav is the label of the page in the sidebar, pages without one are not listed
+	Nav string
+
+	// Section is the path of the sidebar item to highlight, the path of the page itself when empty
+	Section string
+}
+
+// pages are all pages of the site, in the order of the sidebar
+var pages = []Page{
+	{Path: "/at/my/site", Template: "index.html", Nav: "This site"},
+	{Path: "/at/my/links", Template: "new_link.html", Title: "Link Shortener", Nav: "Link Shortener"},
+	{Path: "/at/my/predictions", Template: "predictions.html", Title: "Predictions", Nav: "Predictions"},
+	{Path: "/at/my/predictions/stats", Template: "prediction_stats.html", Title: "Prediction stats", Section: "/at/my/predictions"},
+	{Path: "/at/dots", Nav: "Dots"},
+	{Path: "/at/my/api", Template: "api_docs.html", Title: "API", Nav: "API"},
+	{Path: "/at/my/faq", Template: "faq.html", Title: "F.A.Q.", Nav: "F.A.Q."},
+	{Path: "/at/my/terms", Template: "terms_and_conditions.html", Title: "Terms and Conditions"},
+}
+
+// navItem is a link in the sidebar
+type navItem struct {
+	Label  string
+	Path   string
+	Active bool
+}
+
+// section returns the path of the sidebar item of the page
+func (p Page) section() string {
+	if p.Section != "" {
+		return p.Section
+	}
+	return p.Path
+}
+
+// navigation returns the sidebar items of pages, with the item of the page rendering template active
+func navigation(pages []Page, template string) []navItem {
+
+	active := ""
+	for _, page := range pages {
+		if page.Template != "" && page.Template == template {
+			active = page.section()
+		}
+	}
+
+	var items []navItem
+	for _, page := range pages {
+		if page.Nav != "" {
+			items = append(items, navItem{Label: page.Nav, Path: page.Path, Active: page.Path == active})
+		}
+	}
+
+	return items
+}
+
+// registerPages adds a route for every page with a template. Pages showing more than
+// the template use a handler from handlers, the others render the template without data.
+func registerPages(e *echo.Echo, pages []Page, handlers map[string]echo.HandlerFunc) {
+	for _, page := range pages {
+		if page.Template == "" {
+			continue
+		}
+
+		handler, ok := handlers[page.Template]
+		if !ok {
+			handler = renderTemplateView(page.Template)
+		}
+
+		e.GET(page.Path, handler)
+	}
+}
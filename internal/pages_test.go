@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNavigation(t *testing.T) {
+
+	items := navigation(pages, "prediction_stats.html")
+	assert.Equal(t, []navItem{
+		{Label: "This site", Path: "/at/my/site"},
+		{Label: "Link Shortener", Path: "/at/my/links"},
+		{Label: "Predictions", Path: "/at/my/predictions", Active: true},
+		{Label: "Dots", Path: "/at/dots"},
+		{Label: "API", Path: "/at/my/api"},
+		{Label: "F.A.Q.", Path: "/at/my/faq"},
+	}, items)
+
+	for _, item := range navigation(pages, "not_found.html") {
+		assert.False(t, item.Active)
+	}
+}
+
+func TestRegisterPages(t *testing.T) {
+
+	e := echo.New()
+	registerPages(e, pages, map[string]echo.HandlerFunc{
+		"predictions.html": func(c echo.Context) error { return c.NoContent(http.StatusTeapot) },
+	})
+
+	registered := make(map[string]bool)
+	for _, route := range e.Routes() {
+		registered[route.Path] = true
+	}
+
+	for _, page := range pages {
+		assert.Equal(t, page.Template != "", registered[page.Path], page.Path)
+	}
+}
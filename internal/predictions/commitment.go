@@ -0,0 +1,22 @@
+package predictions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+// commitmentRegex matches a hex encoded SHA-256 hash
+var commitmentRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Commit returns the commitment to a prediction: the hex encoded SHA-256 of salt + ":" + text.
+// The salt keeps short predictions from being guessed by hashing likely texts.
+func Commit(text, salt string) string {
+	hash := sha256.Sum256([]byte(salt + ":" + text))
+	return hex.EncodeToString(hash[:])
+}
+
+// validCommitment checks if commitment looks like the output of Commit
+func validCommitment(commitment string) bool {
+	return commitmentRegex.MatchString(commitment)
+}
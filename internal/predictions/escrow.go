@@ -0,0 +1,275 @@
+package predictions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/lk16/heyluuk/internal/logging"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	// escrowNonceSize is the size of a NaCl box nonce
+	escrowNonceSize = 24
+
+	// escrowRetryMin and escrowRetryMax bound the wait after a failed reveal from escrow,
+	// which doubles with every attempt
+	escrowRetryMin = time.Minute
+	escrowRetryMax = 24 * time.Hour
+
+	// reveal entries in the log tell who revealed a prediction
+	revealByAuthor = ""
+	revealByEscrow = "escrow"
+)
+
+// escrowBatchSize limits the number of predictions revealed by one run of the Revealer
+var escrowBatchSize = 100
+
+var (
+	errEscrowDisabled   = errors.New("Escrow is not enabled on this server")
+	errInvalidEscrow    = errors.New("Escrow cannot be decrypted with the escrow key")
+	errEscrowMismatch   = errors.New("Escrow does not match the commitment")
+	errInvalidEscrowKey = errors.New("Escrow key must be a base64 encoded Curve25519 private key")
+)
+
+// escrowContent is what an escrow encrypts
+type escrowContent struct {
+	Text string `json:"text"`
+	Salt string `json:"salt"`
+}
+
+// Escrow encrypts text and salt to the escrow key of the server, for the escrow field of a new
+// prediction. It is the base64 encoding of an ephemeral public key, a nonce and the NaCl box.
+func Escrow(random io.Reader, escrowKey *[32]byte, text, salt string) (string, error) {
+
+	publicKey, privateKey, err := box.GenerateKey(random)
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [escrowNonceSize]byte
+	if _, err := io.ReadFull(random, nonce[:]); err != nil {
+		return "", err
+	}
+
+	content, err := json.Marshal(escrowContent{Text: text, Salt: salt})
+	if err != nil {
+		return "", err
+	}
+
+	sealed := append(publicKey[:], nonce[:]...)
+	sealed = box.Seal(sealed, content, &nonce, escrowKey, privateKey)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// ParseEscrowKey decodes a base64 encoded Curve25519 private key
+func ParseEscrowKey(encoded string) (*[32]byte, error) {
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) != 32 {
+		return nil, errInvalidEscrowKey
+	}
+
+	var key [32]byte
+	copy(key[:], decoded)
+	return &key, nil
+}
+
+// EscrowPublicKey returns the public key escrows are encrypted to
+func EscrowPublicKey(privateKey *[32]byte) *[32]byte {
+	var publicKey [32]byte
+	curve25519.ScalarBaseMult(&publicKey, privateKey)
+	return &publicKey
+}
+
+// openEscrow decrypts an escrow made by Escrow
+func openEscrow(privateKey *[32]byte, escrow string) (escrowContent, error) {
+
+	decoded, err := base64.StdEncoding.DecodeString(escrow)
+	if err != nil || len(decoded) < 32+escrowNonceSize+box.Overhead {
+		return escrowContent{}, errInvalidEscrow
+	}
+
+	var publicKey [32]byte
+	var nonce [escrowNonceSize]byte
+	copy(publicKey[:], decoded)
+	copy(nonce[:], decoded[32:])
+
+	opened, ok := box.Open(nil, decoded[32+escrowNonceSize:], &nonce, &publicKey, privateKey)
+	if !ok {
+		return escrowContent{}, errInvalidEscrow
+	}
+
+	var content escrowContent
+	if err := json.Unmarshal(opened, &content); err != nil {
+		return escrowContent{}, errInvalidEscrow
+	}
+
+	return content, nil
+}
+
+// checkEscrow makes sure an escrow can be revealed later, so authors learn about mistakes right away
+func (cont *Controller) checkEscrow(escrow, commitment string) error {
+
+	if cont.EscrowKey == nil {
+		return errEscrowDisabled
+	}
+
+	content, err := openEscrow(cont.EscrowKey, escrow)
+	if err != nil {
+		return err
+	}
+
+	if len(content.Text) > maxTextLength {
+		return errTextTooLong
+	}
+
+	if Commit(content.Text, content.Salt) != commitment {
+		return errEscrowMismatch
+	}
+
+	return nil
+}
+
+// escrowRetryDelay returns how long to wait after the given number of failed reveals from escrow
+func escrowRetryDelay(attempts int) time.Duration {
+
+	delay := escrowRetryMin
+	for i := 1; i < attempts && delay < escrowRetryMax; i++ {
+		delay *= 2
+	}
+
+	if delay > escrowRetryMax {
+		return escrowRetryMax
+	}
+	return delay
+}
+
+// escrowFailed records a failed reveal from escrow, so the prediction is skipped until it is retried
+func (cont *Controller) escrowFailed(prediction *Prediction) error {
+
+	attempts := prediction.EscrowAttempts + 1
+	retryAt := cont.time().Add(escrowRetryDelay(attempts))
+
+	return cont.DB.Model(prediction).Updates(map[string]interface{}{
+		"escrow_attempts": attempts,
+		"escrow_retry_at": retryAt,
+	}).Error
+}
+
+// revealEscrowed reveals escrowed predictions whose reveal date has passed, it returns how many.
+// Predictions failing to reveal are retried later, escrows made with a rotated key reveal
+// once the key is back.
+func (cont *Controller) revealEscrowed(logger logrus.FieldLogger) (int, error) {
+
+	now := cont.time()
+
+	var due []Prediction
+	err := cont.DB.Where("escrow <> '' AND revealed_at IS NULL AND reveal_at <= ?", now).
+		Where("escrow_retry_at IS NULL OR escrow_retry_at <= ?", now).
+		Order("reveal_at").Limit(escrowBatchSize).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	revealed := 0
+
+	for i := range due {
+		prediction := &due[i]
+
+		content, err := openEscrow(cont.EscrowKey, prediction.Escrow)
+		if err == nil {
+			err = cont.reveal(prediction, content.Text, content.Salt, revealByEscrow)
+		}
+
+		switch err {
+		case nil:
+			revealed++
+			logger.WithField(logging.FieldPredictionID, prediction.ID).Info("prediction revealed from escrow")
+		case errAlreadyRevealed:
+			// the author was just in time
+		default:
+			logger := logger.WithField(logging.FieldPredictionID, prediction.ID).WithField("attempts", prediction.EscrowAttempts+1)
+			logger.WithError(err).Error("revealing prediction from escrow failed")
+
+			if err := cont.escrowFailed(prediction); err != nil {
+				logger.WithError(err).Error("recording failed reveal from escrow failed")
+			}
+		}
+	}
+
+	return revealed, nil
+}
+
+// Revealer reveals escrowed predictions in the background
+type Revealer struct {
+	cont   *Controller
+	logger logrus.FieldLogger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+}
+
+// NewRevealer returns a Revealer for the predictions of cont, it needs an escrow key
+func NewRevealer(cont *Controller) (*Revealer, error) {
+
+	if cont.EscrowKey == nil {
+		return nil, errEscrowDisabled
+	}
+
+	logger := cont.Logger
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	return &Revealer{
+		cont:   cont,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// Run reveals due predictions once
+func (r *Revealer) Run() {
+	if _, err := r.cont.revealEscrowed(r.logger); err != nil {
+		r.logger.WithError(err).Error("finding escrowed predictions failed")
+	}
+}
+
+// Start reveals due predictions every interval, until Close is called
+func (r *Revealer) Start(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.Run()
+			}
+		}
+	}()
+}
+
+// Close stops revealing predictions and waits for a running reveal to finish
+func (r *Revealer) Close() error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	r.done.Wait()
+	return nil
+}
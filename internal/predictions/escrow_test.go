@@ -0,0 +1,310 @@
+package predictions
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testEscrowKey returns a deterministic escrow private key
+func testEscrowKey(seed byte) *[32]byte {
+	var key [32]byte
+	copy(key[:], bytes.Repeat([]byte{seed}, 32))
+	return &key
+}
+
+// escrowBody returns a JSON body committing to text with reveal date revealAt, with an escrow
+// of text encrypted to escrowKey
+func escrowBody(t *testing.T, text string, escrowKey *[32]byte, revealAt time.Time) string {
+
+	escrow, err := Escrow(rand.Reader, EscrowPublicKey(escrowKey), text, "salt")
+	assert.Nil(t, err)
+
+	body, _ := json.Marshal(PostPredictionBody{Commitment: Commit(text, "salt"), RevealAt: revealAt, Escrow: escrow})
+	return string(body)
+}
+
+func TestEscrow(t *testing.T) {
+
+	key := testEscrowKey(1)
+
+	escrow, err := Escrow(rand.Reader, EscrowPublicKey(key), "it will rain", "salt")
+	assert.Nil(t, err)
+
+	content, err := openEscrow(key, escrow)
+	assert.Nil(t, err)
+	assert.Equal(t, escrowContent{Text: "it will rain", Salt: "salt"}, content)
+
+	_, err = openEscrow(testEscrowKey(2), escrow)
+	assert.Equal(t, errInvalidEscrow, err)
+
+	decoded, _ := base64.StdEncoding.DecodeString(escrow)
+	decoded[len(decoded)-1] ^= 1
+	_, err = openEscrow(key, base64.StdEncoding.EncodeToString(decoded))
+	assert.Equal(t, errInvalidEscrow, err)
+
+	_, err = openEscrow(key, "YWJj")
+	assert.Equal(t, errInvalidEscrow, err)
+}
+
+func TestParseEscrowKey(t *testing.T) {
+
+	key, err := ParseEscrowKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	assert.Nil(t, err)
+	assert.Equal(t, testEscrowKey(1), key)
+
+	_, err = ParseEscrowKey("YWJj")
+	assert.Equal(t, errInvalidEscrowKey, err)
+}
+
+func TestControllerPostPredictionEscrowInvalid(t *testing.T) {
+
+	// all of these are rejected before the database is used
+	cont := testController(nil)
+
+	rec := post(t, cont, escrowBody(t, "rain", testEscrowKey(1), testNow.Add(time.Hour)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errEscrowDisabled.Error()+`"}`, rec.Body.String())
+
+	cont.EscrowKey = testEscrowKey(1)
+
+	rec = post(t, cont, escrowBody(t, "rain", testEscrowKey(2), testNow.Add(time.Hour)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errInvalidEscrow.Error()+`"}`, rec.Body.String())
+
+	// the escrow holds a different text than the commitment
+	var body PostPredictionBody
+	assert.Nil(t, json.Unmarshal([]byte(escrowBody(t, "rain", testEscrowKey(1), testNow.Add(time.Hour))), &body))
+	body.Commitment = Commit("sun", "salt")
+	encoded, _ := json.Marshal(body)
+
+	rec = post(t, cont, string(encoded))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errEscrowMismatch.Error()+`"}`, rec.Body.String())
+}
+
+func TestNewRevealer(t *testing.T) {
+
+	_, err := NewRevealer(testController(nil))
+	assert.Equal(t, errEscrowDisabled, err)
+
+	cont := testController(nil)
+	cont.EscrowKey = testEscrowKey(1)
+
+	revealer, err := NewRevealer(cont)
+	assert.Nil(t, err)
+
+	// Close works without Start and more than once
+	assert.Nil(t, revealer.Close())
+	assert.Nil(t, revealer.Close())
+}
+
+func TestEscrowRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Minute, escrowRetryDelay(1))
+	assert.Equal(t, 2*time.Minute, escrowRetryDelay(2))
+	assert.Equal(t, 8*time.Minute, escrowRetryDelay(4))
+	assert.Equal(t, 24*time.Hour, escrowRetryDelay(20))
+	assert.Equal(t, 24*time.Hour, escrowRetryDelay(1000))
+}
+
+func TestFeed(t *testing.T) {
+
+	revealedAt := testNow.Add(time.Hour)
+	predictions := []Prediction{
+		{ID: 2, Text: "sun & rain", CreatedAt: testNow, RevealedAt: &revealedAt, Author: "luuk"},
+		{ID: 1, Text: "rain", CreatedAt: testNow, RevealedAt: &testNow},
+	}
+
+	encoded, err := xml.Marshal(feed(predictions, "https://heylu.uk", testNow.Add(2*time.Hour)))
+	assert.Nil(t, err)
+
+	var parsed atomFeed
+	assert.Nil(t, xml.Unmarshal(encoded, &parsed))
+	assert.Equal(t, "2020-04-01T13:00:00Z", parsed.Updated)
+	assert.Equal(t, 2, len(parsed.Entries))
+	assert.Equal(t, "https://heylu.uk/api/prediction/2", parsed.Entries[0].ID)
+	assert.Equal(t, "sun & rain", parsed.Entries[0].Content.Body)
+	assert.Equal(t, "luuk", parsed.Entries[0].Author.Name)
+	assert.Nil(t, parsed.Entries[1].Author)
+
+	empty := feed(nil, "https://heylu.uk", testNow)
+	assert.Equal(t, "2020-04-01T12:00:00Z", empty.Updated)
+}
+
+func TestParsePublicURL(t *testing.T) {
+
+	for raw, expected := range map[string]string{
+		"https://heylu.uk":       "https://heylu.uk",
+		"https://heylu.uk/":      "https://heylu.uk",
+		"http://localhost:8080":  "http://localhost:8080",
+		"https://example.com/me": "https://example.com/me",
+	} {
+		parsed, err := ParsePublicURL(raw)
+		assert.Nil(t, err, raw)
+		assert.Equal(t, expected, parsed)
+	}
+
+	for _, raw := range []string{"heylu.uk", "/at/my/site", "ftp://heylu.uk", "https://heylu.uk/?a=b", "https://heylu.uk/#top"} {
+		_, err := ParsePublicURL(raw)
+		assert.NotNil(t, err, raw)
+	}
+}
+
+func TestControllerEscrow(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	cont := testController(db)
+	cont.EscrowKey = testEscrowKey(1)
+
+	// clean up after this test finishes
+	defer cleanup(t, db)
+
+	var created []Prediction
+	for _, text := range []string{"it will rain", "it will snow"} {
+		rec := post(t, cont, escrowBody(t, text, cont.EscrowKey, testNow.Add(time.Hour)))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var prediction Prediction
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &prediction))
+		assert.Empty(t, prediction.Text)
+		created = append(created, prediction)
+	}
+
+	logger := logrus.StandardLogger()
+
+	t.Run("NotDue", func(t *testing.T) {
+		revealed, err := cont.revealEscrowed(logger)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, revealed)
+	})
+
+	cont.now = func() time.Time { return testNow.Add(2 * time.Hour) }
+
+	// the author of the second prediction reveals it just before the revealer
+	c, rec := idContext(http.MethodPost, `{"text": "it will snow", "salt": "salt"}`, fmt.Sprint(created[1].ID))
+	assert.Nil(t, cont.RevealPrediction(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	t.Run("Due", func(t *testing.T) {
+		revealed, err := cont.revealEscrowed(logger)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, revealed)
+
+		var prediction Prediction
+		assert.Nil(t, db.Find(&prediction, "id = ?", created[0].ID).Error)
+		assert.Equal(t, "it will rain", prediction.Text)
+
+		revealed, err = cont.revealEscrowed(logger)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, revealed)
+	})
+
+	t.Run("Log", func(t *testing.T) {
+		var entries []LogEntry
+		assert.Nil(t, db.Order("seq").Find(&entries).Error)
+		assert.Equal(t, 4, len(entries))
+
+		var data revealData
+		assert.Nil(t, json.Unmarshal([]byte(entries[3].Data), &data))
+		assert.Equal(t, revealByEscrow, data.By)
+
+		_, err := VerifyLog(export(entries))
+		assert.Nil(t, err)
+	})
+
+	t.Run("Feed", func(t *testing.T) {
+		getFeed := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/at/my/predictions/feed.atom", nil)
+			req.Host = "spoofed.example.com"
+			rec := httptest.NewRecorder()
+			assert.Nil(t, cont.Feed(echo.New().NewContext(req, rec)))
+			return rec
+		}
+
+		assert.Equal(t, http.StatusNotFound, getFeed().Code)
+
+		cont.PublicURL = "https://heylu.uk"
+		defer func() { cont.PublicURL = "" }()
+
+		rec := getFeed()
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var parsed atomFeed
+		assert.Nil(t, xml.Unmarshal(rec.Body.Bytes(), &parsed))
+		assert.Equal(t, 2, len(parsed.Entries))
+		assert.Equal(t, "https://heylu.uk/at/my/predictions", parsed.ID)
+		assert.NotContains(t, rec.Body.String(), "spoofed")
+	})
+}
+
+func TestControllerEscrowRetry(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	cont := testController(db)
+	logger := logrus.StandardLogger()
+
+	// clean up after this test finishes
+	defer cleanup(t, db)
+
+	// reveal one prediction per run, so a failing one would hold up the other
+	defer func(size int) { escrowBatchSize = size }(escrowBatchSize)
+	escrowBatchSize = 1
+
+	// the first prediction is escrowed to a key which is rotated afterwards
+	cont.EscrowKey = testEscrowKey(1)
+	rec := post(t, cont, escrowBody(t, "it will rain", cont.EscrowKey, testNow.Add(time.Hour)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var stuck Prediction
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &stuck))
+
+	cont.EscrowKey = testEscrowKey(2)
+	rec = post(t, cont, escrowBody(t, "it will snow", cont.EscrowKey, testNow.Add(2*time.Hour)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	due := testNow.Add(3 * time.Hour)
+	cont.now = func() time.Time { return due }
+
+	revealed, err := cont.revealEscrowed(logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, revealed)
+
+	assert.Nil(t, db.Find(&stuck, "id = ?", stuck.ID).Error)
+	assert.Equal(t, 1, stuck.EscrowAttempts)
+	assert.Equal(t, due.Add(time.Minute).Unix(), stuck.EscrowRetryAt.Unix())
+
+	// the failed prediction waits, so the next one is revealed
+	revealed, err = cont.revealEscrowed(logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, revealed)
+
+	revealed, err = cont.revealEscrowed(logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, revealed)
+
+	// the old key is back and the retry is due
+	cont.EscrowKey = testEscrowKey(1)
+	cont.now = func() time.Time { return due.Add(time.Minute) }
+
+	revealed, err = cont.revealEscrowed(logger)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, revealed)
+
+	assert.Nil(t, db.Find(&stuck, "id = ?", stuck.ID).Error)
+	assert.Equal(t, "it will rain", stuck.Text)
+}
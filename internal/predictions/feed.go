@@ -0,0 +1,138 @@
+package predictions
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// feedSize is the number of revealed predictions in the Atom feed
+	feedSize = 20
+
+	mimeAtom = "application/atom+xml"
+)
+
+var errPublicURL = errors.New("public URL must be an absolute http or https URL without query")
+
+// ParsePublicURL checks the address the site is reachable at and removes a trailing slash
+func ParsePublicURL(raw string) (string, error) {
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", errPublicURL
+	}
+
+	return strings.TrimSuffix(raw, "/"), nil
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Link      atomLink    `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// feed builds an Atom feed of revealed predictions, newest reveal first. Links start with baseURL.
+func feed(predictions []Prediction, baseURL string, now time.Time) atomFeed {
+
+	result := atomFeed{
+		ID:      baseURL + "/at/my/predictions",
+		Title:   "Revealed predictions",
+		Updated: now.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "heyluuk"},
+		Links: []atomLink{
+			{Href: baseURL + "/at/my/predictions/feed.atom", Rel: "self", Type: mimeAtom},
+			{Href: baseURL + "/at/my/predictions", Rel: "alternate", Type: "text/html"},
+		},
+		Entries: []atomEntry{},
+	}
+
+	if len(predictions) > 0 {
+		result.Updated = predictions[0].RevealedAt.UTC().Format(time.RFC3339)
+	}
+
+	for _, prediction := range predictions {
+		entry := atomEntry{
+			ID:        fmt.Sprintf("%s/api/prediction/%d", baseURL, prediction.ID),
+			Title:     fmt.Sprintf("Prediction #%d revealed", prediction.ID),
+			Updated:   prediction.RevealedAt.UTC().Format(time.RFC3339),
+			Published: prediction.CreatedAt.UTC().Format(time.RFC3339),
+			Link:      atomLink{Href: fmt.Sprintf("%s/api/prediction/%d", baseURL, prediction.ID), Rel: "alternate", Type: "application/json"},
+			Content:   atomContent{Type: "text", Body: prediction.Text},
+		}
+
+		if prediction.Author != "" {
+			entry.Author = &atomAuthor{Name: prediction.Author}
+		}
+
+		result.Entries = append(result.Entries, entry)
+	}
+
+	return result
+}
+
+// Feed is an Atom feed of the latest revealed predictions
+func (cont *Controller) Feed(c echo.Context) error {
+
+	// IDs of entries must not depend on the host or proxy serving the request
+	if cont.PublicURL == "" {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	var revealed []Prediction
+	err := cont.DB.Where("revealed_at IS NOT NULL").Order("revealed_at DESC, id DESC").Limit(feedSize).Find(&revealed).Error
+	if err != nil {
+		cont.logger(c).WithError(err).Error("listing revealed predictions failed")
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, mimeAtom+"; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+
+	if _, err := c.Response().Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(c.Response())
+	encoder.Indent("", "  ")
+	return encoder.Encode(feed(revealed, cont.PublicURL, cont.time()))
+}
@@ -0,0 +1,421 @@
+package predictions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/logging"
+)
+
+const (
+	logKindCommit = "commit"
+	logKindReveal = "reveal"
+
+	// logLockKey identifies the advisory lock serializing appends, it is "predlog" in ASCII
+	logLockKey int64 = 0x707265646c6f67
+
+	mimeJSONLines = "application/x-ndjson"
+)
+
+// GenesisHash is the previous hash of the first log entry
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+var (
+	errLogSequence = errors.New("log entry out of sequence")
+	errLogPrevHash = errors.New("log entry does not follow the previous entry")
+	errLogHash     = errors.New("log entry hash is wrong")
+	errLogData     = errors.New("log entry data is invalid")
+	errLogReveal   = errors.New("revealed text and salt do not match the commitment")
+	errLogHead     = errors.New("head is not in the log")
+	errProof       = errors.New("inclusion proof does not lead to the head")
+	errNotLogged   = errors.New("Prediction was made before the log existed")
+)
+
+// LogEntry is a database model for one entry in the append-only prediction log
+type LogEntry struct {
+	Seq          uint   `gorm:"primary_key" json:"seq"`
+	Kind         string `gorm:"not null" json:"kind"`
+	PredictionID uint   `gorm:"not null" json:"prediction_id"`
+
+	// Data is the JSON encoded content of the entry, it is hashed exactly as stored
+	Data     string `gorm:"not null" json:"data"`
+	PrevHash string `gorm:"not null" json:"prev_hash"`
+	Hash     string `gorm:"not null" json:"hash"`
+}
+
+// TableName returns the name of the table associated with this model
+func (LogEntry) TableName() string {
+	return "prediction_log"
+}
+
+// Head is the last entry of the log, publishing it commits to the whole log up to it
+type Head struct {
+	Seq  uint   `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// InclusionProof shows an entry is part of the log up to Head without the rest of the log:
+// hashing the entry and then the data hash of every later entry in turn results in the head hash
+type InclusionProof struct {
+	Entry LogEntry `json:"entry"`
+
+	// Path has the data hashes of the entries after Entry up to and including the head
+	Path []string `json:"path"`
+	Head Head     `json:"head"`
+}
+
+// commitData is the data of a commit entry
+type commitData struct {
+	PredictionID uint      `json:"prediction_id"`
+	Commitment   string    `json:"commitment"`
+	CreatedAt    time.Time `json:"created_at"`
+	RevealAt     time.Time `json:"reveal_at"`
+	Category     string    `json:"category,omitempty"`
+	Probability  *float64  `json:"probability,omitempty"`
+
+	Author          string     `json:"author,omitempty"`
+	KeyID           *uint      `json:"key_id,omitempty"`
+	SignedAt        *time.Time `json:"signed_at,omitempty"`
+	Signature       string     `json:"signature,omitempty"`
+	ServerSignature string     `json:"server_signature,omitempty"`
+	Escrowed        bool       `json:"escrowed,omitempty"`
+}
+
+// revealData is the data of a reveal entry
+type revealData struct {
+	PredictionID uint      `json:"prediction_id"`
+	Text         string    `json:"text"`
+	Salt         string    `json:"salt"`
+	RevealedAt   time.Time `json:"revealed_at"`
+
+	// By is revealByEscrow when the server revealed the prediction, empty when the author did
+	By string `json:"by,omitempty"`
+}
+
+func sha256Hex(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+// DataHash returns the hex encoded SHA-256 of the data of an entry
+func DataHash(data string) string {
+	return sha256Hex(data)
+}
+
+// EntryHash returns the hash of an entry: SHA-256 of the previous hash, a colon and the data hash
+func EntryHash(prevHash, dataHash string) string {
+	return sha256Hex(prevHash + ":" + dataHash)
+}
+
+// appendLog adds an entry to the log, tx must be a transaction so concurrent appends wait for each other
+func appendLog(tx *gorm.DB, kind string, predictionID uint, data interface{}) (*LogEntry, error) {
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", logLockKey).Error; err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := logHead(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &LogEntry{
+		Seq:          head.Seq + 1,
+		Kind:         kind,
+		PredictionID: predictionID,
+		Data:         string(encoded),
+		PrevHash:     head.Hash,
+	}
+	entry.Hash = EntryHash(entry.PrevHash, DataHash(entry.Data))
+
+	if err = tx.Create(entry).Error; err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// logHead returns the last entry of the log, or the genesis hash when it is empty
+func logHead(db *gorm.DB) (Head, error) {
+
+	var last LogEntry
+	err := db.Order("seq DESC").Limit(1).Find(&last).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		return Head{Seq: 0, Hash: GenesisHash}, nil
+	}
+
+	if err != nil {
+		return Head{}, err
+	}
+
+	return Head{Seq: last.Seq, Hash: last.Hash}, nil
+}
+
+// inclusionProof builds a proof that entry is part of the log up to the current head
+func inclusionProof(db *gorm.DB, entry LogEntry) (*InclusionProof, error) {
+
+	proof := &InclusionProof{Entry: entry, Path: []string{}}
+
+	rows, err := db.Model(&LogEntry{}).Where("seq > ?", entry.Seq).Order("seq").Select("seq, data, hash").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	proof.Head = Head{Seq: entry.Seq, Hash: entry.Hash}
+
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&proof.Head.Seq, &data, &proof.Head.Hash); err != nil {
+			return nil, err
+		}
+		proof.Path = append(proof.Path, DataHash(data))
+	}
+
+	return proof, rows.Err()
+}
+
+// Verify checks that the entry of the proof is part of the log up to its head
+func (proof InclusionProof) Verify() error {
+
+	hash := EntryHash(proof.Entry.PrevHash, DataHash(proof.Entry.Data))
+	if hash != proof.Entry.Hash {
+		return errLogHash
+	}
+
+	for _, dataHash := range proof.Path {
+		hash = EntryHash(hash, dataHash)
+	}
+
+	if hash != proof.Head.Hash || proof.Entry.Seq+uint(len(proof.Path)) != proof.Head.Seq {
+		return errProof
+	}
+
+	return nil
+}
+
+// LogVerifier checks a log one entry at a time, so an export does not need to fit in memory.
+// Besides the hash chain it checks that every reveal matches the commitment it reveals.
+type LogVerifier struct {
+	head        Head
+	predictions map[uint]*loggedPrediction
+	heads       map[string]bool
+}
+
+// loggedPrediction is the state of a prediction according to the log entries checked so far
+type loggedPrediction struct {
+	commitment string
+	revealed   bool
+	resolved   bool
+}
+
+// NewLogVerifier returns a LogVerifier expecting the log to start at the genesis hash
+func NewLogVerifier() *LogVerifier {
+	return &LogVerifier{
+		head:        Head{Seq: 0, Hash: GenesisHash},
+		predictions: make(map[uint]*loggedPrediction),
+		heads:       make(map[string]bool),
+	}
+}
+
+// Add checks the next entry of the log
+func (v *LogVerifier) Add(entry LogEntry) error {
+
+	if entry.Seq != v.head.Seq+1 {
+		return fmt.Errorf("entry %d: %w", entry.Seq, errLogSequence)
+	}
+
+	if entry.PrevHash != v.head.Hash {
+		return fmt.Errorf("entry %d: %w", entry.Seq, errLogPrevHash)
+	}
+
+	if EntryHash(entry.PrevHash, DataHash(entry.Data)) != entry.Hash {
+		return fmt.Errorf("entry %d: %w", entry.Seq, errLogHash)
+	}
+
+	if err := v.apply(entry); err != nil {
+		return fmt.Errorf("entry %d: %w", entry.Seq, err)
+	}
+
+	v.head = Head{Seq: entry.Seq, Hash: entry.Hash}
+	v.heads[entry.Hash] = true
+	return nil
+}
+
+// apply checks an entry makes sense for the state of its prediction and updates that state
+func (v *LogVerifier) apply(entry LogEntry) error {
+
+	prediction := v.predictions[entry.PredictionID]
+
+	switch entry.Kind {
+	case logKindCommit:
+		var data commitData
+		if err := json.Unmarshal([]byte(entry.Data), &data); err != nil || data.PredictionID != entry.PredictionID || prediction != nil {
+			return errLogData
+		}
+		v.predictions[data.PredictionID] = &loggedPrediction{commitment: data.Commitment}
+
+	case logKindReveal:
+		var data revealData
+		if err := json.Unmarshal([]byte(entry.Data), &data); err != nil || data.PredictionID != entry.PredictionID ||
+			prediction == nil || prediction.revealed || (data.By != revealByAuthor && data.By != revealByEscrow) {
+			return errLogData
+		}
+		if Commit(data.Text, data.Salt) != prediction.commitment {
+			return errLogReveal
+		}
+		prediction.revealed = true
+
+	case logKindOutcome:
+		var data outcomeData
+		if err := json.Unmarshal([]byte(entry.Data), &data); err != nil || data.PredictionID != entry.PredictionID ||
+			prediction == nil || !prediction.revealed || prediction.resolved || !validOutcome(data.Outcome) {
+			return errLogData
+		}
+		prediction.resolved = true
+
+	default:
+		return fmt.Errorf("unknown kind %q: %w", entry.Kind, errLogData)
+	}
+
+	return nil
+}
+
+// Head returns the last entry checked so far
+func (v *LogVerifier) Head() Head {
+	return v.head
+}
+
+// Contains checks if a previously published head hash is part of the log, which shows
+// the log has only been appended to since
+func (v *LogVerifier) Contains(hash string) error {
+	if !v.heads[hash] {
+		return errLogHead
+	}
+	return nil
+}
+
+// GetLogHead returns the current head of the prediction log
+func (cont *Controller) GetLogHead(c echo.Context) error {
+
+	head, err := logHead(cont.DB)
+	if err != nil {
+		cont.logger(c).WithError(err).Error("getting log head failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+
+	return c.JSON(http.StatusOK, head)
+}
+
+// GetLog streams the whole prediction log as JSON lines, oldest entry first
+func (cont *Controller) GetLog(c echo.Context) error {
+
+	rows, err := cont.DB.Model(&LogEntry{}).Order("seq").Rows()
+	if err != nil {
+		cont.logger(c).WithError(err).Error("exporting log failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+	defer rows.Close()
+
+	c.Response().Header().Set(echo.HeaderContentType, mimeJSONLines)
+	c.Response().WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Response())
+
+	for rows.Next() {
+		var entry LogEntry
+		if err = cont.DB.ScanRows(rows, &entry); err != nil {
+			break
+		}
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = rows.Err()
+	}
+
+	// the status has been sent already, so a truncated export is all we can do
+	if err != nil {
+		cont.logger(c).WithError(err).Error("exporting log failed")
+	}
+
+	return nil
+}
+
+// GetProof returns an inclusion proof for the commit entry of a prediction
+func (cont *Controller) GetProof(c echo.Context) error {
+
+	prediction, err := cont.getPrediction(c)
+
+	switch err {
+	case nil:
+	case errInvalidID:
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errPredictionNotFound:
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	default:
+		cont.logger(c).WithError(err).Error("getting prediction failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+
+	var entry LogEntry
+	err = cont.DB.Find(&entry, "prediction_id = ? AND kind = ?", prediction.ID, logKindCommit).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		response := ErrorResponse{Error: errNotLogged.Error()}
+		return c.JSON(http.StatusNotFound, response)
+	}
+
+	var proof *InclusionProof
+	if err == nil {
+		proof, err = inclusionProof(cont.DB, entry)
+	}
+
+	if err != nil {
+		cont.logger(c).WithField(logging.FieldPredictionID, prediction.ID).WithError(err).Error("building inclusion proof failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+
+	return c.JSON(http.StatusOK, proof)
+}
+
+// VerifyLog checks a log exported by GetLog, which is read as a stream of JSON entries
+func VerifyLog(r io.Reader) (*LogVerifier, error) {
+
+	verifier := NewLogVerifier()
+	decoder := json.NewDecoder(r)
+
+	for {
+		var entry LogEntry
+		err := decoder.Decode(&entry)
+
+		if err == io.EOF {
+			return verifier, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("after entry %d: %w", verifier.Head().Seq, err)
+		}
+
+		if err = verifier.Add(entry); err != nil {
+			return nil, err
+		}
+	}
+}
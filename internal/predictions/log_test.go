@@ -0,0 +1,209 @@
+package predictions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// chain links entries like appendLog does, without a database
+func chain(entries ...LogEntry) []LogEntry {
+
+	prevHash := GenesisHash
+	for i := range entries {
+		entries[i].Seq = uint(i + 1)
+		entries[i].PrevHash = prevHash
+		entries[i].Hash = EntryHash(prevHash, DataHash(entries[i].Data))
+		prevHash = entries[i].Hash
+	}
+
+	return entries
+}
+
+func commitEntry(ID uint, text, salt string) LogEntry {
+	data, _ := json.Marshal(commitData{PredictionID: ID, Commitment: Commit(text, salt), CreatedAt: testNow, RevealAt: testNow})
+	return LogEntry{Kind: logKindCommit, PredictionID: ID, Data: string(data)}
+}
+
+func revealEntry(ID uint, text, salt string) LogEntry {
+	data, _ := json.Marshal(revealData{PredictionID: ID, Text: text, Salt: salt, RevealedAt: testNow})
+	return LogEntry{Kind: logKindReveal, PredictionID: ID, Data: string(data)}
+}
+
+// export encodes entries like GetLog
+func export(entries []LogEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		encoder.Encode(entry)
+	}
+	return &buf
+}
+
+func TestEntryHash(t *testing.T) {
+	// echo -n "0000000000000000000000000000000000000000000000000000000000000000:$(echo -n '{}' | sha256sum | cut -c1-64)" | sha256sum
+	assert.Equal(t, "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", DataHash("{}"))
+	assert.Equal(t, sha256Hex(GenesisHash+":"+DataHash("{}")), EntryHash(GenesisHash, DataHash("{}")))
+}
+
+func TestVerifyLog(t *testing.T) {
+
+	valid := func() []LogEntry {
+		return chain(commitEntry(1, "rain", "a"), commitEntry(2, "sun", "b"), revealEntry(1, "rain", "a"))
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		entries := valid()
+		verifier, err := VerifyLog(export(entries))
+		assert.Nil(t, err)
+		assert.Equal(t, Head{Seq: 3, Hash: entries[2].Hash}, verifier.Head())
+		assert.Nil(t, verifier.Contains(entries[1].Hash))
+		assert.True(t, errors.Is(verifier.Contains(strings.Repeat("f", 64)), errLogHead))
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		verifier, err := VerifyLog(&bytes.Buffer{})
+		assert.Nil(t, err)
+		assert.Equal(t, Head{Seq: 0, Hash: GenesisHash}, verifier.Head())
+	})
+
+	type testCase struct {
+		name     string
+		tamper   func(entries []LogEntry) []LogEntry
+		expected error
+	}
+
+	testCases := []testCase{
+		{"EditedData", func(entries []LogEntry) []LogEntry {
+			entries[1].Data = strings.Replace(entries[1].Data, "2020", "2019", 1)
+			return entries
+		}, errLogHash},
+		{"Rehashed", func(entries []LogEntry) []LogEntry {
+			// recomputing the edited entry's hash breaks the link of the next one
+			entries[1].Data = strings.Replace(entries[1].Data, "2020", "2019", 1)
+			entries[1].Hash = EntryHash(entries[1].PrevHash, DataHash(entries[1].Data))
+			return entries
+		}, errLogPrevHash},
+		{"Removed", func(entries []LogEntry) []LogEntry {
+			return append(entries[:1], entries[2:]...)
+		}, errLogSequence},
+		{"WrongReveal", func(entries []LogEntry) []LogEntry {
+			return chain(entries[0], entries[1], revealEntry(1, "sun", "a"))
+		}, errLogReveal},
+		{"UnknownRevealer", func(entries []LogEntry) []LogEntry {
+			data, _ := json.Marshal(revealData{PredictionID: 1, Text: "rain", Salt: "a", RevealedAt: testNow, By: "admin"})
+			return chain(entries[0], entries[1], LogEntry{Kind: logKindReveal, PredictionID: 1, Data: string(data)})
+		}, errLogData},
+		{"UnknownKind", func(entries []LogEntry) []LogEntry {
+			entries[2].Kind = "edit"
+			return entries
+		}, errLogData},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := VerifyLog(export(testCase.tamper(valid())))
+			assert.True(t, errors.Is(err, testCase.expected), "%v", err)
+		})
+	}
+
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := VerifyLog(strings.NewReader("{"))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestInclusionProofVerify(t *testing.T) {
+
+	entries := chain(commitEntry(1, "rain", "a"), commitEntry(2, "sun", "b"), revealEntry(1, "rain", "a"))
+
+	proof := InclusionProof{
+		Entry: entries[0],
+		Path:  []string{DataHash(entries[1].Data), DataHash(entries[2].Data)},
+		Head:  Head{Seq: 3, Hash: entries[2].Hash},
+	}
+	assert.Nil(t, proof.Verify())
+
+	head := InclusionProof{Entry: entries[2], Path: []string{}, Head: proof.Head}
+	assert.Nil(t, head.Verify())
+
+	proof.Path = proof.Path[:1]
+	assert.Equal(t, errProof, proof.Verify())
+
+	proof.Entry.Data = entries[1].Data
+	assert.Equal(t, errLogHash, proof.Verify())
+}
+
+func TestControllerLog(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	cont := testController(db)
+	e := echo.New()
+
+	// clean up after this test finishes
+	defer cleanup(t, db)
+
+	var IDs []string
+	for _, text := range []string{"rain", "sun", "snow"} {
+		rec := post(t, cont, postBody(text, testNow.Add(time.Hour)))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var prediction Prediction
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &prediction))
+		IDs = append(IDs, fmt.Sprint(prediction.ID))
+	}
+
+	cont.now = func() time.Time { return testNow.Add(2 * time.Hour) }
+
+	c, rec := idContext(http.MethodPost, `{"text": "sun", "salt": "salt"}`, IDs[1])
+	assert.Nil(t, cont.RevealPrediction(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	assert.Nil(t, cont.GetLogHead(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+
+	var head Head
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &head))
+	assert.Equal(t, uint(4), head.Seq)
+
+	t.Run("Export", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		assert.Nil(t, cont.GetLog(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+		assert.Equal(t, mimeJSONLines, rec.Header().Get(echo.HeaderContentType))
+
+		verifier, err := VerifyLog(rec.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, head, verifier.Head())
+	})
+
+	t.Run("Proof", func(t *testing.T) {
+		c, rec := idContext(http.MethodGet, "", IDs[0])
+		assert.Nil(t, cont.GetProof(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var proof InclusionProof
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &proof))
+		assert.Nil(t, proof.Verify())
+		assert.Equal(t, head, proof.Head)
+		assert.Equal(t, 3, len(proof.Path))
+	})
+
+	t.Run("AppendOnly", func(t *testing.T) {
+		err := db.Exec("UPDATE prediction_log SET data = '{}' WHERE seq = 1").Error
+		assert.NotNil(t, err)
+
+		err = db.Exec("DELETE FROM prediction_log WHERE seq = 4").Error
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,7 @@
+-- This table holds all published predictions, so rolling back past this migration is refused
+-- instead of dropping it.
+DO $$
+BEGIN
+    RAISE EXCEPTION 'rolling back 0001_create_predictions would drop all predictions, drop prediction by hand instead';
+END
+$$;
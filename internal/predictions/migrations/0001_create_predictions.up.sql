@@ -0,0 +1,10 @@
+CREATE TABLE prediction (
+    id serial PRIMARY KEY,
+    commitment text NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    reveal_at timestamp with time zone NOT NULL
+);
+
+-- the first commitment to a hash wins, so nobody can claim a prediction by copying its hash
+CREATE UNIQUE INDEX prediction_commitment_idx ON prediction (commitment);
+CREATE INDEX prediction_reveal_at_idx ON prediction (reveal_at);
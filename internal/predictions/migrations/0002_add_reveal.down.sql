@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS prediction_revealed_at_idx;
+
+ALTER TABLE prediction
+    DROP COLUMN IF EXISTS text,
+    DROP COLUMN IF EXISTS salt,
+    DROP COLUMN IF EXISTS revealed_at;
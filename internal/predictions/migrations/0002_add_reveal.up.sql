@@ -0,0 +1,7 @@
+-- text and salt stay empty until the author reveals the prediction
+ALTER TABLE prediction
+    ADD COLUMN text text NOT NULL DEFAULT '',
+    ADD COLUMN salt text NOT NULL DEFAULT '',
+    ADD COLUMN revealed_at timestamp with time zone;
+
+CREATE INDEX prediction_revealed_at_idx ON prediction (revealed_at) WHERE revealed_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS prediction_log;
+DROP FUNCTION IF EXISTS prediction_log_append_only();
@@ -0,0 +1,21 @@
+-- Every commitment and reveal is appended to this log. The hash of an entry covers its data
+-- and the hash of the previous entry, so editing or backdating one breaks every later hash.
+CREATE TABLE prediction_log (
+    seq bigint PRIMARY KEY,
+    kind text NOT NULL,
+    prediction_id integer NOT NULL REFERENCES prediction (id),
+    data text NOT NULL,
+    prev_hash text NOT NULL UNIQUE,
+    hash text NOT NULL UNIQUE
+);
+
+CREATE INDEX prediction_log_prediction_id_idx ON prediction_log (prediction_id);
+
+CREATE FUNCTION prediction_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'prediction_log is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER prediction_log_append_only BEFORE UPDATE OR DELETE ON prediction_log
+    FOR EACH ROW EXECUTE PROCEDURE prediction_log_append_only();
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS prediction_resolved_idx;
+
+ALTER TABLE prediction
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS probability,
+    DROP COLUMN IF EXISTS outcome,
+    DROP COLUMN IF EXISTS resolved_at;
@@ -0,0 +1,8 @@
+-- category and probability are stated when committing, the outcome is set after the reveal
+ALTER TABLE prediction
+    ADD COLUMN category text NOT NULL DEFAULT '',
+    ADD COLUMN probability double precision CHECK (probability >= 0 AND probability <= 1),
+    ADD COLUMN outcome text NOT NULL DEFAULT '' CHECK (outcome IN ('', 'true', 'false', 'ambiguous')),
+    ADD COLUMN resolved_at timestamp with time zone;
+
+CREATE INDEX prediction_resolved_idx ON prediction (category) WHERE outcome <> '';
@@ -0,0 +1,8 @@
+ALTER TABLE prediction
+    DROP COLUMN IF EXISTS author,
+    DROP COLUMN IF EXISTS key_id,
+    DROP COLUMN IF EXISTS signed_at,
+    DROP COLUMN IF EXISTS signature,
+    DROP COLUMN IF EXISTS server_signature;
+
+DROP TABLE IF EXISTS author_key;
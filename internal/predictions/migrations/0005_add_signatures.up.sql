@@ -0,0 +1,18 @@
+-- Ed25519 public keys of prediction authors, an author can have several
+CREATE TABLE author_key (
+    id serial PRIMARY KEY,
+    author text NOT NULL,
+    public_key text NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
+CREATE UNIQUE INDEX author_key_public_key_idx ON author_key (public_key);
+CREATE INDEX author_key_author_idx ON author_key (author);
+
+-- signatures of the author over the commitment and signing time, and the receipt of the server
+ALTER TABLE prediction
+    ADD COLUMN author text NOT NULL DEFAULT '',
+    ADD COLUMN key_id integer REFERENCES author_key (id),
+    ADD COLUMN signed_at timestamp with time zone,
+    ADD COLUMN signature text NOT NULL DEFAULT '',
+    ADD COLUMN server_signature text NOT NULL DEFAULT '';
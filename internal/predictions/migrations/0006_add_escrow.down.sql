@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS prediction_escrow_due_idx;
+
+ALTER TABLE prediction
+    DROP COLUMN IF EXISTS escrow;
@@ -0,0 +1,5 @@
+-- text and salt encrypted to the escrow key of the server, for revealing automatically
+ALTER TABLE prediction
+    ADD COLUMN escrow text NOT NULL DEFAULT '';
+
+CREATE INDEX prediction_escrow_due_idx ON prediction (reveal_at) WHERE escrow <> '' AND revealed_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE prediction
+    DROP COLUMN IF EXISTS escrow_retry_at,
+    DROP COLUMN IF EXISTS escrow_attempts;
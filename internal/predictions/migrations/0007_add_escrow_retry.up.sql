@@ -0,0 +1,4 @@
+-- failed reveals from escrow are retried with backoff, so they do not hold up other predictions
+ALTER TABLE prediction
+    ADD COLUMN escrow_attempts integer NOT NULL DEFAULT 0,
+    ADD COLUMN escrow_retry_at timestamptz;
@@ -0,0 +1 @@
+ALTER TABLE author_key DROP COLUMN IF EXISTS revoked_at;
@@ -0,0 +1,2 @@
+-- authors rotate keys by registering a new key signed by the old one, which is then revoked
+ALTER TABLE author_key ADD COLUMN revoked_at timestamp with time zone;
@@ -0,0 +1,165 @@
+package predictions
+
+import (
+	"time"
+
+	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+)
+
+// Prediction is a database model, it only stores a commitment until the prediction is revealed
+type Prediction struct {
+	ID         uint      `gorm:"primary_key" json:"id"`
+	Commitment string    `gorm:"not null;unique_index:prediction_commitment_idx" json:"commitment"`
+	CreatedAt  time.Time `gorm:"not null" json:"created_at"`
+	RevealAt   time.Time `gorm:"not null;index:prediction_reveal_at_idx" json:"reveal_at"`
+
+	// Text and Salt are empty and RevealedAt is nil until the prediction is revealed
+	Text       string     `gorm:"not null" json:"text,omitempty"`
+	Salt       string     `gorm:"not null" json:"salt,omitempty"`
+	RevealedAt *time.Time `gorm:"index:prediction_revealed_at_idx" json:"revealed_at"`
+
+	// Category and Probability are optional and stated when committing, Probability is
+	// the chance the author gives the prediction of coming true
+	Category    string   `gorm:"not null" json:"category,omitempty"`
+	Probability *float64 `json:"probability"`
+
+	// Outcome is empty and ResolvedAt is nil until the prediction is resolved
+	Outcome    string     `gorm:"not null" json:"outcome,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+
+	// Author, KeyID, SignedAt and Signature are only set for predictions signed by a registered author
+	Author    string     `gorm:"not null" json:"author,omitempty"`
+	KeyID     *uint      `json:"key_id"`
+	SignedAt  *time.Time `json:"signed_at"`
+	Signature string     `gorm:"not null" json:"signature,omitempty"`
+
+	// ServerSignature is the receipt of the server, empty when it has no signing key
+	ServerSignature string `gorm:"not null" json:"server_signature,omitempty"`
+
+	// Escrow holds the text and salt encrypted to the escrow key, so the server can reveal them
+	Escrow string `gorm:"not null" json:"-"`
+
+	// EscrowAttempts counts failed reveals from escrow, the next one waits until EscrowRetryAt
+	EscrowAttempts int        `gorm:"not null" json:"-"`
+	EscrowRetryAt  *time.Time `json:"-"`
+}
+
+// Escrowed checks if the server can reveal the prediction automatically
+func (p Prediction) Escrowed() bool {
+	return p.Escrow != ""
+}
+
+// Signed checks if the prediction carries a signature of its author
+func (p Prediction) Signed() bool {
+	return p.Signature != ""
+}
+
+// Revealed checks if the text of the prediction has been published
+func (p Prediction) Revealed() bool {
+	return p.RevealedAt != nil
+}
+
+// Resolved checks if the outcome of the prediction is known
+func (p Prediction) Resolved() bool {
+	return p.Outcome != ""
+}
+
+// TableName returns the name of the table associated with this model
+func (Prediction) TableName() string {
+	return "prediction"
+}
+
+// CodeChallengeFailed is the code of error responses for wrong challenge answers, like in the redirect package
+const CodeChallengeFailed = "challenge_failed"
+
+// ErrorResponse is a JSON response model
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// PostPredictionBody is used by a JSON request model
+type PostPredictionBody struct {
+	Commitment  string    `json:"commitment"`
+	RevealAt    time.Time `json:"reveal_at"`
+	Category    string    `json:"category"`
+	Probability *float64  `json:"probability"`
+
+	// Author, SignedAt and Signature are optional, they are required together
+	Author    string     `json:"author"`
+	SignedAt  *time.Time `json:"signed_at"`
+	Signature string     `json:"signature"`
+
+	// Escrow is optional, it lets the server reveal the prediction at the reveal date
+	Escrow string `json:"escrow"`
+
+	botstopper.Response
+}
+
+// RevealPredictionBody is used by a JSON request model
+type RevealPredictionBody struct {
+	Text string `json:"text"`
+	Salt string `json:"salt"`
+}
+
+// VerifyPredictionBody is used by a JSON request model
+type VerifyPredictionBody struct {
+	Text string `json:"text"`
+	Salt string `json:"salt"`
+}
+
+// VerifyPredictionResponse is a JSON response model
+type VerifyPredictionResponse struct {
+	Commitment string `json:"commitment"`
+
+	// Prediction is the stored prediction with this commitment, nil when there is none
+	Prediction *Prediction `json:"prediction"`
+}
+
+// ResolvePredictionBody is used by a JSON request model
+type ResolvePredictionBody struct {
+	Outcome string `json:"outcome"`
+}
+
+// AuthorKey is a database model, it holds a public key an author signs predictions with
+type AuthorKey struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	Author    string    `gorm:"not null;index:author_key_author_idx" json:"author"`
+	PublicKey string    `gorm:"not null;unique_index:author_key_public_key_idx" json:"public_key"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+
+	// RevokedAt is nil until the author rotates the key, revoked keys cannot sign new predictions
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// TableName returns the name of the table associated with this model
+func (AuthorKey) TableName() string {
+	return "author_key"
+}
+
+// PostAuthorKeyBody is used by a JSON request model
+type PostAuthorKeyBody struct {
+	Author    string `json:"author"`
+	PublicKey string `json:"public_key"`
+
+	// SignedAt and KeySignature prove the author holds the new key, only the admin can leave them out
+	SignedAt     *time.Time `json:"signed_at"`
+	KeySignature string     `json:"key_signature"`
+
+	// Signature is made by a registered key of the author, it is required when the author has keys
+	Signature string `json:"signature"`
+
+	// Rotate revokes the key that made Signature once the new key is registered
+	Rotate bool `json:"rotate"`
+}
+
+// KeysResponse is a JSON response model
+type KeysResponse struct {
+	// ServerKey verifies server signatures, it is empty when the server does not sign
+	ServerKey string `json:"server_key,omitempty"`
+
+	// EscrowKey is the Curve25519 key escrows are encrypted to, it is empty when escrow is disabled
+	EscrowKey string `json:"escrow_key,omitempty"`
+
+	Authors []AuthorKey `json:"authors"`
+}
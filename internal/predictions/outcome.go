@@ -0,0 +1,144 @@
+package predictions
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/auth"
+	"github.com/lk16/heyluuk/internal/logging"
+)
+
+// Outcomes of resolved predictions
+const (
+	OutcomeTrue      = "true"
+	OutcomeFalse     = "false"
+	OutcomeAmbiguous = "ambiguous"
+
+	logKindOutcome = "outcome"
+)
+
+var (
+	// categoryRegex matches optional short category names like "politics" or "tech-2020"
+	categoryRegex = regexp.MustCompile(`^([a-z0-9-]{1,32})?$`)
+
+	errInvalidCategory    = errors.New("Category must be up to 32 lowercase letters, digits and dashes")
+	errInvalidProbability = errors.New("Probability must be between 0 and 1")
+	errInvalidOutcome     = errors.New("Outcome must be true, false or ambiguous")
+	errNotRevealed        = errors.New("Prediction must be revealed before it is resolved")
+	errAlreadyResolved    = errors.New("Prediction has been resolved already")
+	errUnauthorized       = errors.New("Unauthorized")
+)
+
+// outcomeData is the data of an outcome entry in the log
+type outcomeData struct {
+	PredictionID uint      `json:"prediction_id"`
+	Outcome      string    `json:"outcome"`
+	ResolvedAt   time.Time `json:"resolved_at"`
+}
+
+func validCategory(category string) bool {
+	return categoryRegex.MatchString(category)
+}
+
+func validProbability(probability *float64) bool {
+	return probability == nil || (*probability >= 0 && *probability <= 1)
+}
+
+func validOutcome(outcome string) bool {
+	return outcome == OutcomeTrue || outcome == OutcomeFalse || outcome == OutcomeAmbiguous
+}
+
+// isAdmin checks if the request carries the admin token as bearer token
+func (cont *Controller) isAdmin(c echo.Context) bool {
+	return auth.IsAdmin(c, cont.AdminToken)
+}
+
+// resolve sets the outcome of a revealed prediction and appends it to the log
+func (cont *Controller) resolve(prediction *Prediction, outcome string) error {
+
+	if !prediction.Revealed() {
+		return errNotRevealed
+	}
+
+	if prediction.Resolved() {
+		return errAlreadyResolved
+	}
+
+	now := cont.time()
+
+	err := cont.DB.Transaction(func(tx *gorm.DB) error {
+
+		result := tx.Model(&Prediction{}).
+			Where("id = ? AND outcome = ''", prediction.ID).
+			Updates(map[string]interface{}{"outcome": outcome, "resolved_at": now})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errAlreadyResolved
+		}
+
+		_, err := appendLog(tx, logKindOutcome, prediction.ID, outcomeData{
+			PredictionID: prediction.ID,
+			Outcome:      outcome,
+			ResolvedAt:   now,
+		})
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	prediction.Outcome = outcome
+	prediction.ResolvedAt = &now
+	return nil
+}
+
+// ResolvePrediction sets whether a revealed prediction came true, it needs the admin token
+func (cont *Controller) ResolvePrediction(c echo.Context) error {
+
+	if !cont.isAdmin(c) {
+		response := ErrorResponse{Error: errUnauthorized.Error()}
+		return c.JSON(http.StatusUnauthorized, response)
+	}
+
+	body := ResolvePredictionBody{}
+
+	if err := c.Bind(&body); err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	if !validOutcome(body.Outcome) {
+		response := ErrorResponse{Error: errInvalidOutcome.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	prediction, err := cont.getPrediction(c)
+	if err == nil {
+		err = cont.resolve(prediction, body.Outcome)
+	}
+
+	switch err {
+	case nil:
+		cont.logger(c).WithField(logging.FieldPredictionID, prediction.ID).WithField("outcome", body.Outcome).Info("prediction resolved")
+		return c.JSON(http.StatusOK, prediction)
+	case errInvalidID, errNotRevealed:
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errPredictionNotFound:
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errAlreadyResolved:
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	}
+
+	cont.logger(c).WithError(err).Error("resolving prediction failed")
+	response := ErrorResponse{Error: "Resolving prediction failed"}
+	return c.JSON(http.StatusInternalServerError, response)
+}
@@ -0,0 +1,177 @@
+package predictions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func outcomeEntry(ID uint, outcome string) LogEntry {
+	data, _ := json.Marshal(outcomeData{PredictionID: ID, Outcome: outcome, ResolvedAt: testNow})
+	return LogEntry{Kind: logKindOutcome, PredictionID: ID, Data: string(data)}
+}
+
+func TestValidOutcomeFields(t *testing.T) {
+
+	assert.True(t, validCategory(""))
+	assert.True(t, validCategory("tech-2020"))
+	assert.False(t, validCategory("Tech"))
+	assert.False(t, validCategory("a b"))
+
+	half, negative, tooHigh := 0.5, -0.1, 1.1
+	assert.True(t, validProbability(nil))
+	assert.True(t, validProbability(&half))
+	assert.False(t, validProbability(&negative))
+	assert.False(t, validProbability(&tooHigh))
+
+	assert.True(t, validOutcome(OutcomeAmbiguous))
+	assert.False(t, validOutcome(""))
+	assert.False(t, validOutcome("maybe"))
+}
+
+func TestControllerPostPredictionOutcomeFields(t *testing.T) {
+
+	cont := testController(nil)
+
+	rec := post(t, cont, `{"commitment": "`+Commit("a", "b")+`", "reveal_at": "2021-01-01T00:00:00Z", "category": "Tech"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errInvalidCategory.Error()+`"}`, rec.Body.String())
+
+	rec = post(t, cont, `{"commitment": "`+Commit("a", "b")+`", "reveal_at": "2021-01-01T00:00:00Z", "probability": 2}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errInvalidProbability.Error()+`"}`, rec.Body.String())
+}
+
+func TestVerifyLogOutcome(t *testing.T) {
+
+	_, err := VerifyLog(export(chain(commitEntry(1, "rain", "a"), revealEntry(1, "rain", "a"), outcomeEntry(1, OutcomeTrue))))
+	assert.Nil(t, err)
+
+	testCases := map[string][]LogEntry{
+		"NotRevealed": chain(commitEntry(1, "rain", "a"), outcomeEntry(1, OutcomeTrue)),
+		"Twice":       chain(commitEntry(1, "rain", "a"), revealEntry(1, "rain", "a"), outcomeEntry(1, OutcomeTrue), outcomeEntry(1, OutcomeFalse)),
+		"Invalid":     chain(commitEntry(1, "rain", "a"), revealEntry(1, "rain", "a"), outcomeEntry(1, "maybe")),
+	}
+
+	for name, entries := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := VerifyLog(export(entries))
+			assert.True(t, errors.Is(err, errLogData), "%v", err)
+		})
+	}
+}
+
+func TestControllerResolveInvalid(t *testing.T) {
+
+	cont := testController(nil)
+	cont.AdminToken = "secret"
+
+	resolve := func(token, body, ID string) *httptest.ResponseRecorder {
+		c, rec := idContext(http.MethodPost, body, ID)
+		if token != "" {
+			c.Request().Header.Set("Authorization", "Bearer "+token)
+		}
+		assert.Nil(t, cont.ResolvePrediction(c))
+		return rec
+	}
+
+	rec := resolve("", `{"outcome": "true"}`, "1")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = resolve("wrong", `{"outcome": "true"}`, "1")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = resolve("secret", `{"outcome": "maybe"}`, "1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errInvalidOutcome.Error()+`"}`, rec.Body.String())
+
+	rec = resolve("secret", `{"outcome": "true"}`, "x")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errInvalidID.Error()+`"}`, rec.Body.String())
+
+	// without a configured token nobody is admin
+	cont.AdminToken = ""
+	rec = resolve("", `{"outcome": "true"}`, "1")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestControllerResolve(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	cont := testController(db)
+	cont.AdminToken = "secret"
+
+	// clean up after this test finishes
+	defer cleanup(t, db)
+
+	rec := post(t, cont, `{"commitment": "`+Commit("it will rain", "salt")+`", "reveal_at": "`+
+		testNow.Add(time.Hour).Format(time.RFC3339)+`", "category": "weather", "probability": 0.8}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var prediction Prediction
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &prediction))
+	assert.Equal(t, "weather", prediction.Category)
+	assert.Equal(t, 0.8, *prediction.Probability)
+
+	ID := fmt.Sprint(prediction.ID)
+
+	resolve := func(outcome string) *httptest.ResponseRecorder {
+		c, rec := idContext(http.MethodPost, `{"outcome": "`+outcome+`"}`, ID)
+		c.Request().Header.Set("Authorization", "Bearer secret")
+		assert.Nil(t, cont.ResolvePrediction(c))
+		return rec
+	}
+
+	t.Run("NotRevealed", func(t *testing.T) {
+		rec := resolve(OutcomeTrue)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errNotRevealed.Error()+`"}`, rec.Body.String())
+	})
+
+	cont.now = func() time.Time { return testNow.Add(2 * time.Hour) }
+
+	c, rec := idContext(http.MethodPost, `{"text": "it will rain", "salt": "salt"}`, ID)
+	assert.Nil(t, cont.RevealPrediction(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	t.Run("OK", func(t *testing.T) {
+		rec := resolve(OutcomeTrue)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resolved Prediction
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &resolved))
+		assert.Equal(t, OutcomeTrue, resolved.Outcome)
+		assert.True(t, resolved.Resolved())
+	})
+
+	t.Run("Twice", func(t *testing.T) {
+		rec := resolve(OutcomeFalse)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		response, err := cont.stats("")
+		assert.Nil(t, err)
+		assert.Equal(t, PeriodYear, response.Period)
+		assert.Equal(t, 1, response.Overall.Hits)
+		assert.Equal(t, 1, response.Categories["weather"].Scored)
+	})
+
+	t.Run("Log", func(t *testing.T) {
+		var entries []LogEntry
+		assert.Nil(t, db.Order("seq").Find(&entries).Error)
+		assert.Equal(t, 3, len(entries))
+		assert.Equal(t, logKindOutcome, entries[2].Kind)
+
+		_, err := VerifyLog(export(entries))
+		assert.Nil(t, err)
+	})
+}
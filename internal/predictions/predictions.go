@@ -0,0 +1,314 @@
+package predictions
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"embed"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+	"github.com/lk16/heyluuk/internal/clientip"
+	"github.com/lk16/heyluuk/internal/logging"
+	"github.com/lk16/heyluuk/internal/migrate"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// minRevealDelay keeps predictions from being revealed right after they are made
+	minRevealDelay = time.Minute
+
+	// maxRevealDelay keeps reveal dates within reason
+	maxRevealDelay = 10 * 365 * 24 * time.Hour
+
+	// pageSize is the maximum number of predictions listed at once
+	pageSize = 50
+
+	// uniqueViolation is the postgres error code for a violated unique constraint
+	uniqueViolation = "23505"
+)
+
+var (
+	errInvalidCommitment  = errors.New("Commitment must be a hex encoded SHA-256 hash")
+	errRevealTooSoon      = errors.New("Reveal date must be at least a minute in the future")
+	errRevealTooLate      = errors.New("Reveal date is too far in the future")
+	errCommitmentExists   = errors.New("Commitment exists already")
+	errPredictionNotFound = errors.New("Prediction not found")
+	errInvalidID          = errors.New("Invalid id parameter")
+)
+
+// MigrationComponent identifies the migrations of this package in the schema_migrations table
+const MigrationComponent = "predictions"
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator returns a Migrator for the versioned schema migrations of this package
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+
+	migrations, err := migrate.Load(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, MigrationComponent, migrations), nil
+}
+
+// Migrate applies all pending DB migrations
+func Migrate(db *gorm.DB) error {
+
+	migrator, err := NewMigrator(db.DB())
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up(context.Background())
+	return err
+}
+
+// Controller supplies some additional context for all request handlers
+type Controller struct {
+	DB         *gorm.DB
+	BotStopper botstopper.Interface
+
+	// Logger receives all log lines, the standard logrus logger is used when it is nil
+	Logger logrus.FieldLogger
+
+	// AdminToken is required as bearer token for resolving predictions, which is disabled when empty.
+	// It also registers author keys without the signatures authors need.
+	AdminToken string
+
+	// SigningKey countersigns new predictions as a receipt, they are not countersigned when it is nil
+	SigningKey ed25519.PrivateKey
+
+	// EscrowKey decrypts escrows for revealing predictions automatically, escrow is disabled when it is nil
+	EscrowKey *[32]byte
+
+	// PublicURL is the address of the site without trailing slash, it starts the IDs and links
+	// of the Atom feed which is disabled when it is empty
+	PublicURL string
+
+	// now returns the current time, time.Now is used when it is nil
+	now func() time.Time
+}
+
+// logger returns a log entry for the request of c
+func (cont *Controller) logger(c echo.Context) *logrus.Entry {
+	return logging.Request(cont.Logger, c)
+}
+
+// time returns the current time with the precision stored in predictions
+func (cont *Controller) time() time.Time {
+
+	now := time.Now
+	if cont.now != nil {
+		now = cont.now
+	}
+
+	return now().UTC().Truncate(time.Second)
+}
+
+// validRevealAt checks that a reveal date is neither too soon nor too far away
+func validRevealAt(revealAt, now time.Time) error {
+
+	if revealAt.Before(now.Add(minRevealDelay)) {
+		return errRevealTooSoon
+	}
+
+	if revealAt.After(now.Add(maxRevealDelay)) {
+		return errRevealTooLate
+	}
+
+	return nil
+}
+
+// isUniqueViolation checks if err is caused by a violated unique constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// create stores a new prediction and appends its commitment to the log
+func (cont *Controller) create(prediction *Prediction) error {
+
+	return cont.DB.Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Create(prediction).Error; err != nil {
+			return err
+		}
+
+		_, err := appendLog(tx, logKindCommit, prediction.ID, commitData{
+			PredictionID: prediction.ID,
+			Commitment:   prediction.Commitment,
+			CreatedAt:    prediction.CreatedAt,
+			RevealAt:     prediction.RevealAt,
+			Category:     prediction.Category,
+			Probability:  prediction.Probability,
+
+			Author:          prediction.Author,
+			KeyID:           prediction.KeyID,
+			SignedAt:        prediction.SignedAt,
+			Signature:       prediction.Signature,
+			ServerSignature: prediction.ServerSignature,
+			Escrowed:        prediction.Escrowed(),
+		})
+		return err
+	})
+}
+
+// PostPrediction handles POST requests committing to a new prediction
+func (cont *Controller) PostPrediction(c echo.Context) error {
+
+	body := PostPredictionBody{}
+
+	if err := c.Bind(&body); err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	body.Response.Client = clientip.Get(c)
+
+	if !cont.BotStopper.Verify(body.Response) {
+		cont.logger(c).WithField(logging.FieldClientIP, body.Response.Client).Warn("prediction rejected: wrong challenge answer")
+		response := ErrorResponse{Error: "Anti-bot challenge failed", Code: CodeChallengeFailed}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	commitment := strings.ToLower(body.Commitment)
+	if !validCommitment(commitment) {
+		response := ErrorResponse{Error: errInvalidCommitment.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	now := cont.time()
+	revealAt := body.RevealAt.UTC().Truncate(time.Second)
+
+	if err := validRevealAt(revealAt, now); err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	if !validCategory(body.Category) {
+		response := ErrorResponse{Error: errInvalidCategory.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	if !validProbability(body.Probability) {
+		response := ErrorResponse{Error: errInvalidProbability.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	signed := body.Author != "" || body.SignedAt != nil || body.Signature != ""
+
+	if signed {
+		if err := validSignatureFields(body, now); err != nil {
+			response := ErrorResponse{Error: err.Error()}
+			return c.JSON(http.StatusBadRequest, response)
+		}
+	}
+
+	prediction := Prediction{
+		Commitment:  commitment,
+		CreatedAt:   now,
+		RevealAt:    revealAt,
+		Category:    body.Category,
+		Probability: body.Probability,
+	}
+
+	if signed {
+		key, err := cont.authorKey(body, commitment)
+
+		switch err {
+		case nil:
+		case errUnknownAuthor, errInvalidSignature:
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		default:
+			cont.logger(c).WithError(err).Error("checking prediction signature failed")
+			response := ErrorResponse{Error: "Saving prediction failed"}
+			return c.JSON(http.StatusInternalServerError, response)
+		}
+
+		signedAt := body.SignedAt.UTC().Truncate(time.Second)
+		prediction.Author = key.Author
+		prediction.KeyID = &key.ID
+		prediction.SignedAt = &signedAt
+		prediction.Signature = body.Signature
+	}
+
+	if body.Escrow != "" {
+		if err := cont.checkEscrow(body.Escrow, commitment); err != nil {
+			response := ErrorResponse{Error: err.Error()}
+			return c.JSON(http.StatusBadRequest, response)
+		}
+		prediction.Escrow = body.Escrow
+	}
+
+	cont.countersign(&prediction)
+
+	if err := cont.create(&prediction); err != nil {
+		if isUniqueViolation(err) {
+			response := ErrorResponse{Error: errCommitmentExists.Error()}
+			return c.JSON(http.StatusConflict, response)
+		}
+
+		cont.logger(c).WithError(err).Error("saving prediction failed")
+		response := ErrorResponse{Error: "Saving prediction failed"}
+		return c.JSON(http.StatusInternalServerError, response)
+	}
+
+	return c.JSON(http.StatusCreated, prediction)
+}
+
+// GetPredictions lists predictions newest first, a page at a time. The before query parameter
+// is the ID of the last prediction of the previous page.
+func (cont *Controller) GetPredictions(c echo.Context) error {
+
+	before := -1
+	if param := c.QueryParam("before"); param != "" {
+		var err error
+		if before, err = strconv.Atoi(param); err != nil || before < 0 {
+			response := ErrorResponse{Error: "Invalid before parameter"}
+			return c.JSON(http.StatusBadRequest, response)
+		}
+	}
+
+	query := cont.DB.Order("id DESC").Limit(pageSize)
+	if before >= 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	predictions := []Prediction{}
+	err := query.Find(&predictions).Error
+
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		cont.logger(c).WithError(err).Error("listing predictions failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+
+	return c.JSON(http.StatusOK, predictions)
+}
+
+// GetPrediction returns a prediction by ID
+func (cont *Controller) GetPrediction(c echo.Context) error {
+
+	prediction, err := cont.getPrediction(c)
+
+	switch err {
+	case nil:
+		return c.JSON(http.StatusOK, prediction)
+	case errInvalidID:
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errPredictionNotFound:
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	}
+
+	cont.logger(c).WithField(logging.FieldPredictionID, c.Param("id")).WithError(err).Error("getting prediction failed")
+	return c.JSON(http.StatusInternalServerError, nil)
+}
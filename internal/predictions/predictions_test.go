@@ -0,0 +1,353 @@
+package predictions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+	"github.com/lk16/heyluuk/internal/migrate"
+	"github.com/lk16/heyluuk/internal/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testNow = time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+// testDB connects to the test database and applies the migrations of this package
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.OpenGorm(t)
+	assert.Nil(t, Migrate(db))
+	return db
+}
+
+// cleanup removes all predictions and author keys, the log only allows this with TRUNCATE
+func cleanup(t *testing.T, db *gorm.DB) {
+	assert.Nil(t, db.Exec("TRUNCATE prediction_log, prediction, author_key").Error)
+}
+
+// testController returns a Controller accepting every challenge answer at testNow
+func testController(db *gorm.DB) *Controller {
+
+	var verifier botstopper.MockVerifier
+	verifier.On("Verify", mock.Anything).Return(true)
+
+	return &Controller{
+		DB:         db,
+		BotStopper: &verifier,
+		now:        func() time.Time { return testNow },
+	}
+}
+
+// post sends body to PostPrediction
+func post(t *testing.T, cont *Controller, body string) *httptest.ResponseRecorder {
+
+	req := httptest.NewRequest(http.MethodPost, "/api/prediction", strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	rec := httptest.NewRecorder()
+
+	assert.Nil(t, cont.PostPrediction(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+// postBody returns a JSON body committing to text with reveal date revealAt
+func postBody(text string, revealAt time.Time) string {
+	body, _ := json.Marshal(PostPredictionBody{Commitment: Commit(text, "salt"), RevealAt: revealAt})
+	return string(body)
+}
+
+func TestCommit(t *testing.T) {
+
+	// echo -n "salt:hello" | sha256sum
+	assert.Equal(t, "9971ac8c89d23eb086b416752262ed48977d131389ddc3e0c5e6eba4ca02276c", Commit("hello", "salt"))
+	assert.NotEqual(t, Commit("hello", "salt"), Commit("hello", "pepper"))
+	assert.True(t, validCommitment(Commit("hello", "salt")))
+
+	assert.False(t, validCommitment(""))
+	assert.False(t, validCommitment(strings.Repeat("g", 64)))
+	assert.False(t, validCommitment(strings.Repeat("a", 63)))
+}
+
+func TestMigrationsRefuseDroppingTables(t *testing.T) {
+
+	migrations, err := migrate.Load(migrationFiles, "migrations")
+	assert.Nil(t, err)
+
+	// rolling back the first migration would drop every prediction
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Contains(t, migrations[0].Down, "RAISE EXCEPTION")
+	assert.NotContains(t, migrations[0].Down, "DROP TABLE")
+}
+
+func TestValidRevealAt(t *testing.T) {
+	assert.Nil(t, validRevealAt(testNow.Add(time.Hour), testNow))
+	assert.Equal(t, errRevealTooSoon, validRevealAt(testNow.Add(time.Second), testNow))
+	assert.Equal(t, errRevealTooSoon, validRevealAt(testNow.Add(-time.Hour), testNow))
+	assert.Equal(t, errRevealTooLate, validRevealAt(testNow.Add(maxRevealDelay+time.Hour), testNow))
+}
+
+func TestControllerPostPredictionInvalid(t *testing.T) {
+
+	// all of these are rejected before the database is used
+	cont := testController(nil)
+
+	type testCase struct {
+		name          string
+		body          string
+		expectedError string
+	}
+
+	testCases := []testCase{
+		{"InvalidBody", `{"commitment": 3}`, ""},
+		{"InvalidCommitment", `{"commitment": "abc", "reveal_at": "2021-01-01T00:00:00Z"}`, errInvalidCommitment.Error()},
+		{"RevealTooSoon", postBody("soon", testNow.Add(time.Second)), errRevealTooSoon.Error()},
+		{"RevealTooLate", postBody("late", testNow.AddDate(20, 0, 0)), errRevealTooLate.Error()},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rec := post(t, cont, testCase.body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+			var response ErrorResponse
+			assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			if testCase.expectedError != "" {
+				assert.Equal(t, testCase.expectedError, response.Error)
+			}
+		})
+	}
+
+	t.Run("VerifyFail", func(t *testing.T) {
+		var verifier botstopper.MockVerifier
+		verifier.On("Verify", mock.Anything).Return(false)
+
+		cont := testController(nil)
+		cont.BotStopper = &verifier
+
+		rec := post(t, cont, postBody("bot", testNow.Add(time.Hour)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error": "Anti-bot challenge failed", "code": "challenge_failed"}`, rec.Body.String())
+	})
+}
+
+func TestControllerGetInvalid(t *testing.T) {
+
+	cont := testController(nil)
+	e := echo.New()
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/prediction?before=x", nil), rec)
+	assert.Nil(t, cont.GetPredictions(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/api/prediction/x", nil), rec)
+	c.SetParamNames("id")
+	c.SetParamValues("x")
+	assert.Nil(t, cont.GetPrediction(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestControllerPredictions(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	cont := testController(db)
+	e := echo.New()
+
+	// clean up after this test finishes
+	defer cleanup(t, db)
+
+	revealAt := testNow.Add(24 * time.Hour)
+
+	var created []Prediction
+	for _, text := range []string{"first", "second", "third"} {
+		rec := post(t, cont, postBody(text, revealAt.Add(500*time.Millisecond)))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var prediction Prediction
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &prediction))
+		assert.Equal(t, Commit(text, "salt"), prediction.Commitment)
+		assert.True(t, testNow.Equal(prediction.CreatedAt))
+		assert.True(t, revealAt.Equal(prediction.RevealAt), "reveal date is stored in seconds")
+		created = append(created, prediction)
+	}
+
+	t.Run("Duplicate", func(t *testing.T) {
+		rec := post(t, cont, postBody("first", revealAt))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errCommitmentExists.Error()+`"}`, rec.Body.String())
+	})
+
+	t.Run("List", func(t *testing.T) {
+		list := func(query string) []Prediction {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/prediction"+query, nil), rec)
+			assert.Nil(t, cont.GetPredictions(c))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var predictions []Prediction
+			assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &predictions))
+			return predictions
+		}
+
+		all := list("")
+		assert.Equal(t, 3, len(all))
+		assert.Equal(t, created[2].ID, all[0].ID)
+
+		page := list(fmt.Sprintf("?before=%d", created[1].ID))
+		assert.Equal(t, 1, len(page))
+		assert.Equal(t, created[0].ID, page[0].ID)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		get := func(ID uint) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			c.SetParamNames("id")
+			c.SetParamValues(fmt.Sprint(ID))
+			assert.Nil(t, cont.GetPrediction(c))
+			return rec
+		}
+
+		rec := get(created[1].ID)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var prediction Prediction
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &prediction))
+		assert.Equal(t, created[1].Commitment, prediction.Commitment)
+
+		assert.Equal(t, http.StatusNotFound, get(created[2].ID+1).Code)
+	})
+}
+
+// idContext returns a context for a request to a route with an id parameter
+func idContext(method, body, ID string) (echo.Context, *httptest.ResponseRecorder) {
+
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	rec := httptest.NewRecorder()
+
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(ID)
+	return c, rec
+}
+
+func TestControllerRevealInvalid(t *testing.T) {
+
+	cont := testController(nil)
+
+	c, rec := idContext(http.MethodPost, `{"text": "a", "salt": "b"}`, "x")
+	assert.Nil(t, cont.RevealPrediction(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errInvalidID.Error()+`"}`, rec.Body.String())
+
+	long := `{"text": "` + strings.Repeat("a", maxTextLength+1) + `", "salt": "b"}`
+
+	c, rec = idContext(http.MethodPost, long, "1")
+	assert.Nil(t, cont.RevealPrediction(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errTextTooLong.Error()+`"}`, rec.Body.String())
+
+	c, rec = idContext(http.MethodPost, long, "")
+	assert.Nil(t, cont.VerifyPrediction(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestControllerReveal(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	cont := testController(db)
+
+	// clean up after this test finishes
+	defer cleanup(t, db)
+
+	rec := post(t, cont, postBody("it will rain", testNow.Add(time.Hour)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var prediction Prediction
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &prediction))
+	assert.False(t, prediction.Revealed())
+
+	ID := fmt.Sprint(prediction.ID)
+
+	reveal := func(text, salt string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(RevealPredictionBody{Text: text, Salt: salt})
+		c, rec := idContext(http.MethodPost, string(body), ID)
+		assert.Nil(t, cont.RevealPrediction(c))
+		return rec
+	}
+
+	verify := func(text, salt string) VerifyPredictionResponse {
+		body, _ := json.Marshal(VerifyPredictionBody{Text: text, Salt: salt})
+		c, rec := idContext(http.MethodPost, string(body), "")
+		assert.Nil(t, cont.VerifyPrediction(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response VerifyPredictionResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("TooEarly", func(t *testing.T) {
+		rec := reveal("it will rain", "salt")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errRevealTooEarly.Error()+`"}`, rec.Body.String())
+	})
+
+	// from here on the reveal date has passed
+	cont.now = func() time.Time { return testNow.Add(2 * time.Hour) }
+
+	t.Run("Mismatch", func(t *testing.T) {
+		rec := reveal("it will be sunny", "salt")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errMismatch.Error()+`"}`, rec.Body.String())
+	})
+
+	t.Run("VerifyPending", func(t *testing.T) {
+		response := verify("it will rain", "salt")
+		assert.Equal(t, prediction.Commitment, response.Commitment)
+		assert.NotNil(t, response.Prediction)
+		assert.Empty(t, response.Prediction.Text)
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		rec := reveal("it will rain", "salt")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var revealed Prediction
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &revealed))
+		assert.Equal(t, "it will rain", revealed.Text)
+		assert.True(t, testNow.Add(2*time.Hour).Equal(*revealed.RevealedAt))
+	})
+
+	t.Run("Twice", func(t *testing.T) {
+		rec := reveal("it will rain", "salt")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("VerifyRevealed", func(t *testing.T) {
+		response := verify("it will rain", "salt")
+		assert.Equal(t, "it will rain", response.Prediction.Text)
+
+		response = verify("it will rain", "pepper")
+		assert.Nil(t, response.Prediction)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		ID = fmt.Sprint(prediction.ID + 1)
+		rec := reveal("it will rain", "salt")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
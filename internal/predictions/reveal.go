@@ -0,0 +1,202 @@
+package predictions
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/logging"
+)
+
+const (
+	// maxTextLength limits the size of revealed predictions
+	maxTextLength = 10000
+
+	// pageListSize is the number of revealed and pending predictions shown on the page
+	pageListSize = 20
+)
+
+var (
+	errTextTooLong     = errors.New("Text is too long")
+	errRevealTooEarly  = errors.New("Prediction cannot be revealed before its reveal date")
+	errAlreadyRevealed = errors.New("Prediction has been revealed already")
+	errMismatch        = errors.New("Text and salt do not match the commitment")
+)
+
+// getPrediction loads a prediction by the id parameter of the route
+func (cont *Controller) getPrediction(c echo.Context) (*Prediction, error) {
+
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || ID < 0 {
+		return nil, errInvalidID
+	}
+
+	var prediction Prediction
+	err = cont.DB.Find(&prediction, "id = ?", ID).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, errPredictionNotFound
+	}
+
+	return &prediction, err
+}
+
+// reveal publishes the text of a prediction after checking it against the commitment,
+// by is logged to tell who revealed it
+func (cont *Controller) reveal(prediction *Prediction, text, salt, by string) error {
+
+	if prediction.Revealed() {
+		return errAlreadyRevealed
+	}
+
+	now := cont.time()
+	if now.Before(prediction.RevealAt) {
+		return errRevealTooEarly
+	}
+
+	if Commit(text, salt) != prediction.Commitment {
+		return errMismatch
+	}
+
+	err := cont.DB.Transaction(func(tx *gorm.DB) error {
+
+		// the condition on revealed_at makes concurrent reveals of one prediction safe
+		result := tx.Model(&Prediction{}).
+			Where("id = ? AND revealed_at IS NULL", prediction.ID).
+			Updates(map[string]interface{}{"text": text, "salt": salt, "revealed_at": now})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errAlreadyRevealed
+		}
+
+		_, err := appendLog(tx, logKindReveal, prediction.ID, revealData{
+			PredictionID: prediction.ID,
+			Text:         text,
+			Salt:         salt,
+			RevealedAt:   now,
+			By:           by,
+		})
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	prediction.Text = text
+	prediction.Salt = salt
+	prediction.RevealedAt = &now
+	return nil
+}
+
+// RevealPrediction publishes the text and salt of a prediction whose reveal date has passed
+func (cont *Controller) RevealPrediction(c echo.Context) error {
+
+	body := RevealPredictionBody{}
+
+	if err := c.Bind(&body); err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	if len(body.Text) > maxTextLength {
+		response := ErrorResponse{Error: errTextTooLong.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	prediction, err := cont.getPrediction(c)
+	if err == nil {
+		err = cont.reveal(prediction, body.Text, body.Salt, revealByAuthor)
+	}
+
+	switch err {
+	case nil:
+		cont.logger(c).WithField(logging.FieldPredictionID, prediction.ID).Info("prediction revealed")
+		return c.JSON(http.StatusOK, prediction)
+	case errInvalidID, errRevealTooEarly, errMismatch:
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errPredictionNotFound:
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errAlreadyRevealed:
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	}
+
+	cont.logger(c).WithError(err).Error("revealing prediction failed")
+	response := ErrorResponse{Error: "Revealing prediction failed"}
+	return c.JSON(http.StatusInternalServerError, response)
+}
+
+// VerifyPrediction computes the commitment to a text and salt and looks up the prediction
+// committed to it, so anyone can check a prediction without trusting the revealed text
+func (cont *Controller) VerifyPrediction(c echo.Context) error {
+
+	body := VerifyPredictionBody{}
+
+	if err := c.Bind(&body); err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	if len(body.Text) > maxTextLength {
+		response := ErrorResponse{Error: errTextTooLong.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	response := VerifyPredictionResponse{Commitment: Commit(body.Text, body.Salt)}
+
+	var prediction Prediction
+	err := cont.DB.Find(&prediction, "commitment = ?", response.Commitment).Error
+
+	switch {
+	case err == nil:
+		response.Prediction = &prediction
+	case !gorm.IsRecordNotFoundError(err):
+		cont.logger(c).WithError(err).Error("verifying prediction failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// pageData is rendered by the predictions page
+type pageData struct {
+	Revealed []Prediction
+	Pending  []Prediction
+
+	// Now tells which pending predictions can be revealed
+	Now time.Time
+
+	Head Head
+}
+
+// Page shows the latest revealed predictions and the ones to be revealed next
+func (cont *Controller) Page(c echo.Context) error {
+
+	data := pageData{Now: cont.time()}
+
+	err := cont.DB.Where("revealed_at IS NOT NULL").Order("revealed_at DESC").
+		Limit(pageListSize).Find(&data.Revealed).Error
+
+	if err == nil {
+		err = cont.DB.Where("revealed_at IS NULL").Order("reveal_at, id").
+			Limit(pageListSize).Find(&data.Pending).Error
+	}
+
+	if err == nil || gorm.IsRecordNotFoundError(err) {
+		data.Head, err = logHead(cont.DB)
+	}
+
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		// the page is still useful for verifying without the lists
+		cont.logger(c).WithError(err).Error("listing predictions for page failed")
+	}
+
+	return c.Render(http.StatusOK, "predictions.html", data)
+}
@@ -0,0 +1,326 @@
+package predictions
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+)
+
+// maxSignatureSkew is how far the signing time may be from the time a prediction is received
+const maxSignatureSkew = 5 * time.Minute
+
+var (
+	// authorRegex matches author names like "luuk" or "guest-2"
+	authorRegex = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+	errInvalidAuthor     = errors.New("Author must be up to 32 lowercase letters, digits and dashes")
+	errInvalidPublicKey  = errors.New("Public key must be a base64 encoded Ed25519 public key")
+	errInvalidSigningKey = errors.New("Signing key must be a base64 encoded Ed25519 seed")
+	errKeyExists         = errors.New("Public key is registered already")
+	errSignatureFields   = errors.New("Signed predictions need an author, signed_at and signature")
+	errSignatureTime     = errors.New("Signing time must be within 5 minutes of the current time")
+	errUnknownAuthor     = errors.New("Author has no registered keys")
+	errInvalidSignature  = errors.New("Signature does not match any key of the author")
+	errKeyProofFields    = errors.New("Registering a key needs signed_at and key_signature")
+	errKeySignature      = errors.New("Key signature does not match the public key")
+	errKeyNotAuthorized  = errors.New("Adding a key to an author needs a signature of one of its keys")
+)
+
+// SignedMessage returns what an author signs: the commitment and the signing time in seconds
+func SignedMessage(commitment string, signedAt time.Time) []byte {
+	return []byte(commitment + ":" + signedAt.UTC().Format(time.RFC3339))
+}
+
+// Sign returns the base64 encoded signature of an author over a commitment and signing time
+func Sign(key ed25519.PrivateKey, commitment string, signedAt time.Time) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, SignedMessage(commitment, signedAt)))
+}
+
+// KeyMessage returns what is signed to register a key: the author, the new public key and the
+// signing time in seconds. The prefix keeps it apart from the signed message of a prediction.
+func KeyMessage(author, publicKey string, signedAt time.Time) []byte {
+	return []byte("key:" + author + ":" + publicKey + ":" + signedAt.UTC().Format(time.RFC3339))
+}
+
+// SignKey returns the base64 encoded signature of key over the registration of publicKey for author
+func SignKey(key ed25519.PrivateKey, author, publicKey string, signedAt time.Time) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, KeyMessage(author, publicKey, signedAt)))
+}
+
+// ReceiptMessage returns what the server signs when it stores a prediction, it includes the
+// signature of the author so the receipt shows when the server saw it
+func ReceiptMessage(prediction Prediction) []byte {
+	return []byte(strings.Join([]string{
+		prediction.Commitment,
+		prediction.CreatedAt.UTC().Format(time.RFC3339),
+		prediction.RevealAt.UTC().Format(time.RFC3339),
+		prediction.Signature,
+	}, ":"))
+}
+
+// VerifyReceipt checks the server signature of a prediction
+func VerifyReceipt(serverKey ed25519.PublicKey, prediction Prediction) bool {
+	return verify(serverKey, ReceiptMessage(prediction), prediction.ServerSignature)
+}
+
+// ParsePublicKey decodes a base64 encoded Ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errInvalidPublicKey
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// ParseSigningKey decodes a base64 encoded Ed25519 seed into a private key
+func ParseSigningKey(encoded string) (ed25519.PrivateKey, error) {
+
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errInvalidSigningKey
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// verify checks a base64 encoded signature over message
+func verify(key ed25519.PublicKey, message []byte, signature string) bool {
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(decoded) != ed25519.SignatureSize {
+		return false
+	}
+
+	return ed25519.Verify(key, message, decoded)
+}
+
+// validSignatureFields checks the signature fields of a body without using the database
+func validSignatureFields(body PostPredictionBody, now time.Time) error {
+
+	if body.Author == "" || body.SignedAt == nil || body.Signature == "" {
+		return errSignatureFields
+	}
+
+	if !authorRegex.MatchString(body.Author) {
+		return errInvalidAuthor
+	}
+
+	skew := body.SignedAt.Sub(now)
+	if skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return errSignatureTime
+	}
+
+	return nil
+}
+
+// activeKeys returns the keys of author that are not revoked
+func activeKeys(db *gorm.DB, author string) ([]AuthorKey, error) {
+
+	var keys []AuthorKey
+	err := db.Where("author = ? AND revoked_at IS NULL", author).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// signingKey returns the key out of keys that made signature over message
+func signingKey(keys []AuthorKey, message []byte, signature string) (*AuthorKey, error) {
+
+	for i := range keys {
+		key, err := ParsePublicKey(keys[i].PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if verify(key, message, signature) {
+			return &keys[i], nil
+		}
+	}
+
+	return nil, errInvalidSignature
+}
+
+// authorKey returns the key of the author that made the signature in body
+func (cont *Controller) authorKey(body PostPredictionBody, commitment string) (*AuthorKey, error) {
+
+	keys, err := activeKeys(cont.DB, body.Author)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, errUnknownAuthor
+	}
+
+	return signingKey(keys, SignedMessage(commitment, *body.SignedAt), body.Signature)
+}
+
+// checkKeyProof checks that the new key signed its registration, so nobody registers a key
+// they do not hold
+func checkKeyProof(body PostAuthorKeyBody, publicKey ed25519.PublicKey, now time.Time) error {
+
+	if body.SignedAt == nil || body.KeySignature == "" {
+		return errKeyProofFields
+	}
+
+	skew := body.SignedAt.Sub(now)
+	if skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return errSignatureTime
+	}
+
+	if !verify(publicKey, KeyMessage(body.Author, body.PublicKey, *body.SignedAt), body.KeySignature) {
+		return errKeySignature
+	}
+
+	return nil
+}
+
+// registerKey saves the key in body. The first key of an author claims the name, further keys
+// need a signature of a key the author has already, unless the admin registers them.
+func (cont *Controller) registerKey(body PostAuthorKeyBody, admin bool) (*AuthorKey, error) {
+
+	now := cont.time()
+
+	key := &AuthorKey{
+		Author:    body.Author,
+		PublicKey: body.PublicKey,
+		CreatedAt: now,
+	}
+
+	err := cont.DB.Transaction(func(tx *gorm.DB) error {
+
+		// registrations for one author wait for each other, so only one of them claims the name
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key.TableName()+":"+body.Author).Error; err != nil {
+			return err
+		}
+
+		keys, err := activeKeys(tx, body.Author)
+		if err != nil {
+			return err
+		}
+
+		var signer *AuthorKey
+		if body.Signature != "" {
+			signer, err = signingKey(keys, KeyMessage(body.Author, body.PublicKey, *body.SignedAt), body.Signature)
+			if err == errInvalidSignature {
+				return errKeyNotAuthorized
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if signer == nil && (body.Rotate || len(keys) > 0 && !admin) {
+			return errKeyNotAuthorized
+		}
+
+		if err = tx.Create(key).Error; err != nil {
+			return err
+		}
+
+		if body.Rotate {
+			return tx.Model(signer).Update("revoked_at", now).Error
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// countersign adds the server signature to a prediction when the server has a signing key
+func (cont *Controller) countersign(prediction *Prediction) {
+
+	if cont.SigningKey == nil {
+		return
+	}
+
+	signature := ed25519.Sign(cont.SigningKey, ReceiptMessage(*prediction))
+	prediction.ServerSignature = base64.StdEncoding.EncodeToString(signature)
+}
+
+// PostAuthorKey registers a public key of an author. Authors prove they hold the new key with
+// a signature over its registration, the admin token registers a key without proofs.
+func (cont *Controller) PostAuthorKey(c echo.Context) error {
+
+	body := PostAuthorKeyBody{}
+
+	if err := c.Bind(&body); err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	if !authorRegex.MatchString(body.Author) {
+		response := ErrorResponse{Error: errInvalidAuthor.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	publicKey, err := ParsePublicKey(body.PublicKey)
+	if err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	admin := cont.isAdmin(c)
+
+	// signatures of registered keys are over the same message, so they need the proof as well
+	if !admin || body.Signature != "" || body.Rotate {
+		if err = checkKeyProof(body, publicKey, cont.time()); err != nil {
+			response := ErrorResponse{Error: err.Error()}
+			return c.JSON(http.StatusBadRequest, response)
+		}
+	}
+
+	key, err := cont.registerKey(body, admin)
+
+	switch {
+	case err == nil:
+	case err == errKeyNotAuthorized:
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusForbidden, response)
+	case isUniqueViolation(err):
+		response := ErrorResponse{Error: errKeyExists.Error()}
+		return c.JSON(http.StatusConflict, response)
+	default:
+		cont.logger(c).WithError(err).Error("saving author key failed")
+		response := ErrorResponse{Error: "Saving author key failed"}
+		return c.JSON(http.StatusInternalServerError, response)
+	}
+
+	cont.logger(c).WithField("author", key.Author).WithField("rotated", body.Rotate).Info("author key registered")
+	return c.JSON(http.StatusCreated, key)
+}
+
+// GetKeys lists the server keys and all author keys, so anyone can check signatures and make escrows
+func (cont *Controller) GetKeys(c echo.Context) error {
+
+	response := KeysResponse{Authors: []AuthorKey{}}
+
+	if cont.SigningKey != nil {
+		publicKey := cont.SigningKey.Public().(ed25519.PublicKey)
+		response.ServerKey = base64.StdEncoding.EncodeToString(publicKey)
+	}
+
+	if cont.EscrowKey != nil {
+		response.EscrowKey = base64.StdEncoding.EncodeToString(EscrowPublicKey(cont.EscrowKey)[:])
+	}
+
+	err := cont.DB.Order("id").Find(&response.Authors).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		cont.logger(c).WithError(err).Error("listing author keys failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
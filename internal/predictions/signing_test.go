@@ -0,0 +1,369 @@
+package predictions
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// testKey returns a deterministic key pair and its base64 encoded public key
+func testKey(seed byte) (ed25519.PrivateKey, string) {
+	key := ed25519.NewKeyFromSeed([]byte(strings.Repeat(string(rune(seed)), ed25519.SeedSize)))
+	return key, base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// signedBody returns a JSON body committing to text, signed by author with key at signedAt
+func signedBody(text, author string, key ed25519.PrivateKey, signedAt time.Time) string {
+	commitment := Commit(text, "salt")
+	body, _ := json.Marshal(PostPredictionBody{
+		Commitment: commitment,
+		RevealAt:   testNow.Add(time.Hour),
+		Author:     author,
+		SignedAt:   &signedAt,
+		Signature:  Sign(key, commitment, signedAt),
+	})
+	return string(body)
+}
+
+// keyBody returns a JSON body registering the public key of key for author, proving it is held at
+// signedAt. It is signed by signer as well when that is not nil.
+func keyBody(author string, key, signer ed25519.PrivateKey, signedAt time.Time, rotate bool) string {
+
+	publicKey := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	body := PostAuthorKeyBody{
+		Author:       author,
+		PublicKey:    publicKey,
+		SignedAt:     &signedAt,
+		KeySignature: SignKey(key, author, publicKey, signedAt),
+		Rotate:       rotate,
+	}
+
+	if signer != nil {
+		body.Signature = SignKey(signer, author, publicKey, signedAt)
+	}
+
+	encoded, _ := json.Marshal(body)
+	return string(encoded)
+}
+
+// postKey sends body to PostAuthorKey with token as bearer token
+func postKey(t *testing.T, cont *Controller, token, body string) *httptest.ResponseRecorder {
+
+	req := httptest.NewRequest(http.MethodPost, "/api/prediction/key", strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	req.Header.Add("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	assert.Nil(t, cont.PostAuthorKey(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+func TestSign(t *testing.T) {
+
+	key, encoded := testKey('a')
+
+	publicKey, err := ParsePublicKey(encoded)
+	assert.Nil(t, err)
+
+	signature := Sign(key, "abc", testNow)
+	assert.True(t, verify(publicKey, SignedMessage("abc", testNow), signature))
+	assert.True(t, verify(publicKey, SignedMessage("abc", testNow.Add(time.Millisecond)), signature), "signing time is in seconds")
+	assert.False(t, verify(publicKey, SignedMessage("abd", testNow), signature))
+	assert.False(t, verify(publicKey, SignedMessage("abc", testNow.Add(time.Second)), signature))
+	assert.False(t, verify(publicKey, SignedMessage("abc", testNow), "not base64"))
+
+	assert.Equal(t, "abc:2020-04-01T12:00:00Z", string(SignedMessage("abc", testNow.In(time.FixedZone("CEST", 7200)))))
+}
+
+func TestSignKey(t *testing.T) {
+
+	key, encoded := testKey('a')
+	_, other := testKey('b')
+
+	publicKey, err := ParsePublicKey(encoded)
+	assert.Nil(t, err)
+
+	signature := SignKey(key, "luuk", other, testNow)
+	assert.True(t, verify(publicKey, KeyMessage("luuk", other, testNow), signature))
+	assert.False(t, verify(publicKey, KeyMessage("guest", other, testNow), signature))
+	assert.False(t, verify(publicKey, KeyMessage("luuk", encoded, testNow), signature))
+	assert.False(t, verify(publicKey, SignedMessage(other, testNow), signature), "key and prediction signatures differ")
+
+	assert.Equal(t, "key:luuk:"+other+":2020-04-01T12:00:00Z", string(KeyMessage("luuk", other, testNow)))
+}
+
+func TestParseKeys(t *testing.T) {
+
+	_, err := ParsePublicKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Equal(t, errInvalidPublicKey, err)
+
+	_, err = ParsePublicKey("%")
+	assert.Equal(t, errInvalidPublicKey, err)
+
+	key, err := ParseSigningKey(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", ed25519.SeedSize))))
+	assert.Nil(t, err)
+	expected, _ := testKey('a')
+	assert.Equal(t, expected, key)
+
+	_, err = ParseSigningKey("YWJj")
+	assert.Equal(t, errInvalidSigningKey, err)
+}
+
+func TestReceipt(t *testing.T) {
+
+	key, _ := testKey('s')
+	cont := testController(nil)
+	cont.SigningKey = key
+
+	prediction := Prediction{Commitment: Commit("a", "b"), CreatedAt: testNow, RevealAt: testNow.Add(time.Hour)}
+	cont.countersign(&prediction)
+
+	publicKey := key.Public().(ed25519.PublicKey)
+	assert.True(t, VerifyReceipt(publicKey, prediction))
+
+	backdated := prediction
+	backdated.CreatedAt = testNow.Add(-time.Hour)
+	assert.False(t, VerifyReceipt(publicKey, backdated))
+
+	cont.SigningKey = nil
+	unsigned := Prediction{Commitment: Commit("a", "b")}
+	cont.countersign(&unsigned)
+	assert.Empty(t, unsigned.ServerSignature)
+}
+
+func TestControllerPostPredictionSignatureInvalid(t *testing.T) {
+
+	// all of these are rejected before the database is used
+	cont := testController(nil)
+	key, _ := testKey('a')
+
+	type testCase struct {
+		name          string
+		body          string
+		expectedError error
+	}
+
+	testCases := []testCase{
+		{"MissingSignature", `{"commitment": "` + Commit("a", "b") + `", "reveal_at": "2021-01-01T00:00:00Z", "author": "luuk"}`, errSignatureFields},
+		{"InvalidAuthor", signedBody("a", "Luuk", key, testNow), errInvalidAuthor},
+		{"SignedTooEarly", signedBody("a", "luuk", key, testNow.Add(-time.Hour)), errSignatureTime},
+		{"SignedTooLate", signedBody("a", "luuk", key, testNow.Add(time.Hour)), errSignatureTime},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rec := post(t, cont, testCase.body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.JSONEq(t, `{"error": "`+testCase.expectedError.Error()+`"}`, rec.Body.String())
+		})
+	}
+}
+
+func TestControllerPostAuthorKeyInvalid(t *testing.T) {
+
+	// all of these are rejected before the database is used
+	cont := testController(nil)
+	cont.AdminToken = "secret"
+	key, publicKey := testKey('a')
+	otherKey, _ := testKey('b')
+
+	type testCase struct {
+		name          string
+		token         string
+		body          string
+		expectedError error
+	}
+
+	testCases := []testCase{
+		{"InvalidAuthor", "secret", `{"author": "Luuk", "public_key": "` + publicKey + `"}`, errInvalidAuthor},
+		{"InvalidPublicKey", "secret", `{"author": "luuk", "public_key": "YWJj"}`, errInvalidPublicKey},
+		{"MissingProof", "", `{"author": "luuk", "public_key": "` + publicKey + `"}`, errKeyProofFields},
+		{"WrongAdminToken", "wrong", `{"author": "luuk", "public_key": "` + publicKey + `"}`, errKeyProofFields},
+		{"SignedTooEarly", "", keyBody("luuk", key, nil, testNow.Add(-time.Hour), false), errSignatureTime},
+		{"RotateWithoutProof", "secret", `{"author": "luuk", "public_key": "` + publicKey + `", "rotate": true}`, errKeyProofFields},
+	}
+
+	// the key signature is not made by the key that is registered
+	wrongProof := PostAuthorKeyBody{Author: "luuk", PublicKey: publicKey, SignedAt: &testNow}
+	wrongProof.KeySignature = SignKey(otherKey, "luuk", publicKey, testNow)
+	encoded, _ := json.Marshal(wrongProof)
+	testCases = append(testCases, testCase{"WrongKeySignature", "", string(encoded), errKeySignature})
+
+	// the key signature is for another author
+	encoded, _ = json.Marshal(PostAuthorKeyBody{Author: "luuk", PublicKey: publicKey, SignedAt: &testNow,
+		KeySignature: SignKey(key, "other", publicKey, testNow)})
+	testCases = append(testCases, testCase{"OtherAuthor", "", string(encoded), errKeySignature})
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rec := postKey(t, cont, testCase.token, testCase.body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.JSONEq(t, `{"error": "`+testCase.expectedError.Error()+`"}`, rec.Body.String())
+		})
+	}
+}
+
+func TestControllerSignedPredictions(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	serverKey, _ := testKey('s')
+	cont := testController(db)
+	cont.AdminToken = "secret"
+	cont.SigningKey = serverKey
+
+	// clean up after this test finishes
+	defer cleanup(t, db)
+
+	oldKey, oldPublicKey := testKey('o')
+	newKey, newPublicKey := testKey('n')
+	otherKey, _ := testKey('x')
+
+	for _, publicKey := range []string{oldPublicKey, newPublicKey} {
+		rec := postKey(t, cont, "secret", `{"author": "luuk", "public_key": "`+publicKey+`"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	t.Run("DuplicateKey", func(t *testing.T) {
+		rec := postKey(t, cont, "secret", `{"author": "other", "public_key": "`+newPublicKey+`"}`)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/.well-known/prediction-keys.json", nil), rec)
+		assert.Nil(t, cont.GetKeys(c))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response KeysResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, base64.StdEncoding.EncodeToString(serverKey.Public().(ed25519.PublicKey)), response.ServerKey)
+		assert.Equal(t, 2, len(response.Authors))
+		assert.Equal(t, oldPublicKey, response.Authors[0].PublicKey)
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		for _, key := range []ed25519.PrivateKey{oldKey, newKey} {
+			rec := post(t, cont, signedBody(string(key.Seed()[:1]), "luuk", key, testNow.Add(time.Minute)))
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			var prediction Prediction
+			assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &prediction))
+			assert.Equal(t, "luuk", prediction.Author)
+			assert.True(t, prediction.Signed())
+			assert.NotNil(t, prediction.KeyID)
+			assert.True(t, VerifyReceipt(serverKey.Public().(ed25519.PublicKey), prediction))
+		}
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		rec := post(t, cont, signedBody("wrong", "luuk", otherKey, testNow))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errInvalidSignature.Error()+`"}`, rec.Body.String())
+	})
+
+	t.Run("UnknownAuthor", func(t *testing.T) {
+		rec := post(t, cont, signedBody("unknown", "nobody", otherKey, testNow))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errUnknownAuthor.Error()+`"}`, rec.Body.String())
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		rec := post(t, cont, postBody("unsigned", testNow.Add(time.Hour)))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var prediction Prediction
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &prediction))
+		assert.False(t, prediction.Signed())
+		assert.NotEmpty(t, prediction.ServerSignature)
+	})
+}
+
+func TestControllerSelfRegisteredKeys(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	cont := testController(db)
+	cont.AdminToken = "secret"
+
+	// clean up after this test finishes
+	defer cleanup(t, db)
+
+	firstKey, _ := testKey('1')
+	secondKey, _ := testKey('2')
+	thirdKey, _ := testKey('3')
+	otherKey, _ := testKey('x')
+
+	t.Run("FirstKeyClaimsAuthor", func(t *testing.T) {
+		rec := postKey(t, cont, "", keyBody("guest", firstKey, nil, testNow, false))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		rec = post(t, cont, signedBody("first", "guest", firstKey, testNow))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		rec := postKey(t, cont, "", keyBody("guest", secondKey, nil, testNow, false))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errKeyNotAuthorized.Error()+`"}`, rec.Body.String())
+	})
+
+	t.Run("SignedByOtherKey", func(t *testing.T) {
+		rec := postKey(t, cont, "", keyBody("guest", secondKey, otherKey, testNow, false))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errKeyNotAuthorized.Error()+`"}`, rec.Body.String())
+	})
+
+	t.Run("SignedByAuthorKey", func(t *testing.T) {
+		rec := postKey(t, cont, "", keyBody("guest", secondKey, firstKey, testNow, false))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		rec = post(t, cont, signedBody("second", "guest", secondKey, testNow))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("Rotate", func(t *testing.T) {
+		rec := postKey(t, cont, "", keyBody("guest", thirdKey, firstKey, testNow, true))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		// the rotated key is listed with its revocation, so its old signatures can still be checked
+		var keys []AuthorKey
+		assert.Nil(t, db.Where("author = ?", "guest").Order("id").Find(&keys).Error)
+		assert.Equal(t, 3, len(keys))
+		assert.NotNil(t, keys[0].RevokedAt)
+		assert.Nil(t, keys[1].RevokedAt)
+		assert.Nil(t, keys[2].RevokedAt)
+
+		rec = post(t, cont, signedBody("revoked", "guest", firstKey, testNow))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error": "`+errInvalidSignature.Error()+`"}`, rec.Body.String())
+
+		rec = post(t, cont, signedBody("third", "guest", thirdKey, testNow))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		// a revoked key cannot add keys either
+		rec = postKey(t, cont, "", keyBody("guest", otherKey, firstKey, testNow, false))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("RotateNeedsSignature", func(t *testing.T) {
+		rec := postKey(t, cont, "secret", keyBody("guest", otherKey, nil, testNow, true))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("Admin", func(t *testing.T) {
+		rec := postKey(t, cont, "secret", keyBody("guest", otherKey, nil, testNow, false))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+}
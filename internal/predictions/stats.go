@@ -0,0 +1,229 @@
+package predictions
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Periods predictions can be grouped by, based on when they were made
+const (
+	PeriodYear    = "year"
+	PeriodQuarter = "quarter"
+	PeriodMonth   = "month"
+
+	// bucketCount is the number of equally wide probability ranges in calibration
+	bucketCount = 10
+)
+
+var errInvalidPeriod = errors.New("Period must be year, quarter or month")
+
+// CalibrationBucket compares the stated probabilities in a range with how often those predictions came true
+type CalibrationBucket struct {
+	Lower             float64 `json:"lower"`
+	Upper             float64 `json:"upper"`
+	Count             int     `json:"count"`
+	MeanProbability   float64 `json:"mean_probability"`
+	ObservedFrequency float64 `json:"observed_frequency"`
+}
+
+// Stats summarizes how good a group of resolved predictions were
+type Stats struct {
+	// Resolved counts predictions that came true or false, ambiguous ones are not scored
+	Resolved  int `json:"resolved"`
+	Ambiguous int `json:"ambiguous"`
+
+	// Hits counts predictions that came true, or false when the stated probability was below one half
+	Hits    int      `json:"hits"`
+	HitRate *float64 `json:"hit_rate"`
+
+	// Scored counts resolved predictions with a stated probability, which the Brier score and buckets are about
+	Scored     int                 `json:"scored"`
+	BrierScore *float64            `json:"brier_score"`
+	Buckets    []CalibrationBucket `json:"buckets"`
+}
+
+// PeriodStats are the Stats of predictions made in a period
+type PeriodStats struct {
+	Period string `json:"period"`
+
+	Stats
+}
+
+// StatsResponse is a JSON response model
+type StatsResponse struct {
+	Period     string           `json:"period"`
+	Overall    Stats            `json:"overall"`
+	Categories map[string]Stats `json:"categories"`
+	Periods    []PeriodStats    `json:"periods"`
+}
+
+// hit checks if a resolved prediction was right
+func hit(prediction Prediction) bool {
+	if prediction.Probability != nil && *prediction.Probability < 0.5 {
+		return prediction.Outcome == OutcomeFalse
+	}
+	return prediction.Outcome == OutcomeTrue
+}
+
+// bucket returns the index of the calibration bucket of a probability, 1 falls in the last one
+func bucket(probability float64) int {
+	return int(math.Min(probability*bucketCount, bucketCount-1))
+}
+
+// computeStats scores resolved predictions, unresolved ones are ignored
+func computeStats(predictions []Prediction) Stats {
+
+	stats := Stats{Buckets: []CalibrationBucket{}}
+
+	var squaredErrors float64
+	var probabilities, outcomes [bucketCount]float64
+	var counts [bucketCount]int
+
+	for _, prediction := range predictions {
+		switch prediction.Outcome {
+		case OutcomeAmbiguous:
+			stats.Ambiguous++
+			continue
+		case OutcomeTrue, OutcomeFalse:
+		default:
+			continue
+		}
+
+		stats.Resolved++
+		if hit(prediction) {
+			stats.Hits++
+		}
+
+		if prediction.Probability == nil {
+			continue
+		}
+
+		probability := *prediction.Probability
+		outcome := 0.0
+		if prediction.Outcome == OutcomeTrue {
+			outcome = 1
+		}
+
+		stats.Scored++
+		squaredErrors += (probability - outcome) * (probability - outcome)
+
+		i := bucket(probability)
+		counts[i]++
+		probabilities[i] += probability
+		outcomes[i] += outcome
+	}
+
+	if stats.Resolved > 0 {
+		hitRate := float64(stats.Hits) / float64(stats.Resolved)
+		stats.HitRate = &hitRate
+	}
+
+	if stats.Scored > 0 {
+		brierScore := squaredErrors / float64(stats.Scored)
+		stats.BrierScore = &brierScore
+	}
+
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		stats.Buckets = append(stats.Buckets, CalibrationBucket{
+			Lower:             float64(i) / bucketCount,
+			Upper:             float64(i+1) / bucketCount,
+			Count:             count,
+			MeanProbability:   probabilities[i] / float64(count),
+			ObservedFrequency: outcomes[i] / float64(count),
+		})
+	}
+
+	return stats
+}
+
+// periodOf names the period a prediction was made in
+func periodOf(prediction Prediction, period string) string {
+	created := prediction.CreatedAt.UTC()
+	switch period {
+	case PeriodMonth:
+		return created.Format("2006-01")
+	case PeriodQuarter:
+		return fmt.Sprintf("%d-Q%d", created.Year(), (int(created.Month())+2)/3)
+	default:
+		return created.Format("2006")
+	}
+}
+
+// summarize computes Stats for all predictions together, per category and per period
+func summarize(predictions []Prediction, period string) StatsResponse {
+
+	byCategory := make(map[string][]Prediction)
+	byPeriod := make(map[string][]Prediction)
+
+	for _, prediction := range predictions {
+		if prediction.Category != "" {
+			byCategory[prediction.Category] = append(byCategory[prediction.Category], prediction)
+		}
+		name := periodOf(prediction, period)
+		byPeriod[name] = append(byPeriod[name], prediction)
+	}
+
+	response := StatsResponse{
+		Period:     period,
+		Overall:    computeStats(predictions),
+		Categories: make(map[string]Stats, len(byCategory)),
+		Periods:    make([]PeriodStats, 0, len(byPeriod)),
+	}
+
+	for category, group := range byCategory {
+		response.Categories[category] = computeStats(group)
+	}
+
+	for name, group := range byPeriod {
+		response.Periods = append(response.Periods, PeriodStats{Period: name, Stats: computeStats(group)})
+	}
+
+	sort.Slice(response.Periods, func(i, j int) bool {
+		return response.Periods[i].Period < response.Periods[j].Period
+	})
+
+	return response
+}
+
+// stats loads all resolved predictions and summarizes them by period
+func (cont *Controller) stats(period string) (StatsResponse, error) {
+
+	if period == "" {
+		period = PeriodYear
+	}
+
+	if period != PeriodYear && period != PeriodQuarter && period != PeriodMonth {
+		return StatsResponse{}, errInvalidPeriod
+	}
+
+	var predictions []Prediction
+	if err := cont.DB.Where("outcome <> ''").Find(&predictions).Error; err != nil {
+		return StatsResponse{}, err
+	}
+
+	return summarize(predictions, period), nil
+}
+
+// GetStats scores resolved predictions, grouped by the period in the query
+func (cont *Controller) GetStats(c echo.Context) error {
+
+	response, err := cont.stats(c.QueryParam("period"))
+
+	switch err {
+	case nil:
+		return c.JSON(http.StatusOK, response)
+	case errInvalidPeriod:
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	}
+
+	cont.logger(c).WithError(err).Error("computing prediction stats failed")
+	return c.JSON(http.StatusInternalServerError, nil)
+}
@@ -0,0 +1,93 @@
+package predictions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// resolved returns a resolved prediction made at created
+func resolved(created time.Time, category string, probability *float64, outcome string) Prediction {
+	return Prediction{CreatedAt: created, Category: category, Probability: probability, Outcome: outcome}
+}
+
+func probability(p float64) *float64 {
+	return &p
+}
+
+func TestComputeStats(t *testing.T) {
+
+	t.Run("Empty", func(t *testing.T) {
+		stats := computeStats(nil)
+		assert.Nil(t, stats.HitRate)
+		assert.Nil(t, stats.BrierScore)
+		assert.Equal(t, []CalibrationBucket{}, stats.Buckets)
+	})
+
+	stats := computeStats([]Prediction{
+		resolved(testNow, "", probability(0.9), OutcomeTrue),
+		resolved(testNow, "", probability(0.8), OutcomeFalse),
+		resolved(testNow, "", probability(0.2), OutcomeFalse),
+		resolved(testNow, "", probability(1), OutcomeTrue),
+		resolved(testNow, "", nil, OutcomeTrue),
+		resolved(testNow, "", probability(0.5), OutcomeAmbiguous),
+		resolved(testNow, "", probability(0.5), ""),
+	})
+
+	assert.Equal(t, 5, stats.Resolved)
+	assert.Equal(t, 1, stats.Ambiguous)
+	assert.Equal(t, 4, stats.Hits)
+	assert.InDelta(t, 0.8, *stats.HitRate, 1e-9)
+
+	// (0.01 + 0.64 + 0.04 + 0) / 4
+	assert.Equal(t, 4, stats.Scored)
+	assert.InDelta(t, 0.1725, *stats.BrierScore, 1e-9)
+
+	assert.Equal(t, 3, len(stats.Buckets))
+	assert.Equal(t, CalibrationBucket{Lower: 0.2, Upper: 0.3, Count: 1, MeanProbability: 0.2, ObservedFrequency: 0}, stats.Buckets[0])
+	assert.Equal(t, 0.8, stats.Buckets[1].Lower)
+	assert.Equal(t, 1, stats.Buckets[1].Count)
+	assert.Equal(t, 0.9, stats.Buckets[2].Lower)
+	assert.Equal(t, 2, stats.Buckets[2].Count)
+	assert.InDelta(t, 0.95, stats.Buckets[2].MeanProbability, 1e-9)
+	assert.Equal(t, 1.0, stats.Buckets[2].ObservedFrequency)
+}
+
+func TestSummarize(t *testing.T) {
+
+	predictions := []Prediction{
+		resolved(time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC), "tech", probability(0.7), OutcomeTrue),
+		resolved(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), "tech", probability(0.7), OutcomeFalse),
+		resolved(time.Date(2020, 5, 2, 0, 0, 0, 0, time.UTC), "", probability(0.3), OutcomeFalse),
+	}
+
+	response := summarize(predictions, PeriodYear)
+	assert.Equal(t, 3, response.Overall.Resolved)
+	assert.Equal(t, 1, len(response.Categories))
+	assert.Equal(t, 2, response.Categories["tech"].Resolved)
+	assert.Equal(t, 2, len(response.Periods))
+	assert.Equal(t, "2019", response.Periods[0].Period)
+	assert.Equal(t, 2, response.Periods[1].Resolved)
+
+	response = summarize(predictions, PeriodQuarter)
+	assert.Equal(t, []string{"2019-Q4", "2020-Q1", "2020-Q2"}, []string{
+		response.Periods[0].Period, response.Periods[1].Period, response.Periods[2].Period})
+
+	response = summarize(predictions, PeriodMonth)
+	assert.Equal(t, "2020-05", response.Periods[2].Period)
+}
+
+func TestControllerGetStatsInvalid(t *testing.T) {
+
+	cont := testController(nil)
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/prediction/stats?period=week", nil), rec)
+	assert.Nil(t, cont.GetStats(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"error": "`+errInvalidPeriod.Error()+`"}`, rec.Body.String())
+}
@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/clientip"
+)
+
+const pruneInterval = time.Minute
+
+var (
+	errInvalidLimit = errors.New("rate limit should look like 30/m")
+
+	units = map[string]time.Duration{
+		"s": time.Second,
+		"m": time.Minute,
+		"h": time.Hour,
+	}
+)
+
+// Limit allows Burst requests at once, which are replenished at Rate requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses limits such as "30/m", meaning a burst of 30 requests refilling in a minute.
+// An empty string or "off" means no limit, for which nil is returned.
+func ParseLimit(value string) (*Limit, error) {
+
+	value = strings.TrimSpace(value)
+	if value == "" || value == "off" {
+		return nil, nil
+	}
+
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return nil, errInvalidLimit
+	}
+
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 {
+		return nil, errInvalidLimit
+	}
+
+	unit, ok := units[parts[1]]
+	if !ok {
+		return nil, errInvalidLimit
+	}
+
+	limit := &Limit{
+		Rate:  float64(count) / unit.Seconds(),
+		Burst: count,
+	}
+	return limit, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket rate limiter keeping one bucket per key
+type Limiter struct {
+	limit Limit
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewLimiter returns a Limiter for limit
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:     limit,
+		buckets:   make(map[string]*bucket),
+		lastPrune: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// refill adds the tokens earned since the last update of a bucket
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+elapsed*l.limit.Rate)
+	b.last = now
+}
+
+// prune removes buckets that are full again, they behave the same as missing ones
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
+
+// Allow takes a token for key, if none is available it returns how long to wait for one
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+
+	if now.Sub(l.lastPrune) > pruneInterval {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	l.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.tokens) / l.limit.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// Middleware rejects requests of clients exceeding the limit with 429 Too Many Requests
+func (l *Limiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			ok, wait := l.Allow(clientip.Get(c))
+			if ok {
+				return next(c)
+			}
+
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+			response := map[string]string{"error": "Too many requests"}
+			return c.JSON(http.StatusTooManyRequests, response)
+		}
+	}
+}
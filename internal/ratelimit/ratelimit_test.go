@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimit(t *testing.T) {
+
+	type testCase struct {
+		value         string
+		expectedLimit *Limit
+		expectedError error
+	}
+
+	testCases := []testCase{
+		testCase{"", nil, nil},
+		testCase{"off", nil, nil},
+		testCase{"10/s", &Limit{Rate: 10, Burst: 10}, nil},
+		testCase{"30/m", &Limit{Rate: 0.5, Burst: 30}, nil},
+		testCase{"36/h", &Limit{Rate: 0.01, Burst: 36}, nil},
+		testCase{"30", nil, errInvalidLimit},
+		testCase{"0/m", nil, errInvalidLimit},
+		testCase{"a/m", nil, errInvalidLimit},
+		testCase{"30/d", nil, errInvalidLimit},
+	}
+
+	for _, testCase := range testCases {
+		limit, err := ParseLimit(testCase.value)
+		assert.Equalf(t, testCase.expectedLimit, limit, "value=%s", testCase.value)
+		assert.Equalf(t, testCase.expectedError, err, "value=%s", testCase.value)
+	}
+}
+
+// fakeClock lets tests control the time seen by a Limiter
+type fakeClock struct {
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func newTestLimiter(limit Limit) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	l := NewLimiter(limit)
+	l.now = clock.Now
+	return l, clock
+}
+
+func TestLimiterAllow(t *testing.T) {
+
+	t.Run("Burst", func(t *testing.T) {
+		l, _ := newTestLimiter(Limit{Rate: 1, Burst: 3})
+
+		for i := 0; i < 3; i++ {
+			ok, _ := l.Allow("a")
+			assert.True(t, ok)
+		}
+
+		ok, wait := l.Allow("a")
+		assert.False(t, ok)
+		assert.Equal(t, time.Second, wait)
+	})
+
+	t.Run("Refill", func(t *testing.T) {
+		l, clock := newTestLimiter(Limit{Rate: 0.5, Burst: 1})
+
+		ok, _ := l.Allow("a")
+		assert.True(t, ok)
+
+		clock.now = clock.now.Add(time.Second)
+		ok, wait := l.Allow("a")
+		assert.False(t, ok)
+		assert.Equal(t, time.Second, wait)
+
+		clock.now = clock.now.Add(time.Second)
+		ok, _ = l.Allow("a")
+		assert.True(t, ok)
+	})
+
+	t.Run("SeparateKeys", func(t *testing.T) {
+		l, _ := newTestLimiter(Limit{Rate: 1, Burst: 1})
+
+		ok, _ := l.Allow("a")
+		assert.True(t, ok)
+
+		ok, _ = l.Allow("a")
+		assert.False(t, ok)
+
+		ok, _ = l.Allow("b")
+		assert.True(t, ok)
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+		l, clock := newTestLimiter(Limit{Rate: 1, Burst: 1})
+
+		l.Allow("a")
+		l.Allow("b")
+		assert.Equal(t, 2, len(l.buckets))
+
+		clock.now = clock.now.Add(2 * pruneInterval)
+		l.Allow("c")
+		assert.Equal(t, 1, len(l.buckets))
+		assert.Contains(t, l.buckets, "c")
+	})
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+
+	l, _ := newTestLimiter(Limit{Rate: 0.1, Burst: 1})
+	e := echo.New()
+
+	handler := l.Middleware()(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		assert.Nil(t, handler(c))
+		return rec
+	}
+
+	rec := request("1.2.3.4:1234")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = request("1.2.3.4:4321")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error": "Too many requests"}`, rec.Body.String())
+
+	rec = request("5.6.7.8:1234")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,7 @@
+-- These tables hold all links and their history, and may predate versioned migrations,
+-- so rolling back past this migration is refused instead of dropping them.
+DO $$
+BEGIN
+    RAISE EXCEPTION 'rolling back 0001_create_tables would drop all links, drop redirect_node and redirect_revision by hand instead';
+END
+$$;
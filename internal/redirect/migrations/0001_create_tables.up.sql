@@ -0,0 +1,38 @@
+-- Databases created before versioned migrations already have these tables from gorm's
+-- AutoMigrate, so everything here only creates what is missing, using the same names.
+
+CREATE TABLE IF NOT EXISTS redirect_node (
+    id serial PRIMARY KEY,
+    parent_id integer,
+    path_segment text NOT NULL,
+    url text NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS path_segment_parent_id ON redirect_node (parent_id, path_segment);
+CREATE INDEX IF NOT EXISTS parent_idx ON redirect_node (parent_id);
+CREATE INDEX IF NOT EXISTS path_idx ON redirect_node (path_segment);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'redirect_node_parent_id_redirect_node_id_foreign') THEN
+        ALTER TABLE redirect_node ADD CONSTRAINT redirect_node_parent_id_redirect_node_id_foreign
+            FOREIGN KEY (parent_id) REFERENCES redirect_node (id) ON DELETE CASCADE ON UPDATE RESTRICT;
+    END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS redirect_revision (
+    id serial PRIMARY KEY,
+    node_id integer NOT NULL,
+    path text NOT NULL,
+    action text NOT NULL,
+    old_url text NOT NULL,
+    new_url text NOT NULL,
+    actor text NOT NULL,
+    client_ip text NOT NULL,
+    user_agent text NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revision_node_idx ON redirect_revision (node_id);
+CREATE INDEX IF NOT EXISTS revision_path_idx ON redirect_revision (path);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS redirect_node_url_idx;
@@ -0,0 +1,2 @@
+-- speeds up looking up shortcuts by destination, nodes without URL are only path prefixes
+CREATE INDEX IF NOT EXISTS redirect_node_url_idx ON redirect_node (url) WHERE url <> '';
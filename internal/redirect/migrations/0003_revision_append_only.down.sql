@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS redirect_revision_append_only ON redirect_revision;
+DROP FUNCTION IF EXISTS redirect_revision_append_only();
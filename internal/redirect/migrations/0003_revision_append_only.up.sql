@@ -0,0 +1,10 @@
+-- The revision history is the audit trail of all links, so revisions can only be added.
+-- TRUNCATE does not fire row triggers and remains possible for the table owner.
+CREATE FUNCTION redirect_revision_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'redirect_revision is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER redirect_revision_append_only BEFORE UPDATE OR DELETE ON redirect_revision
+    FOR EACH ROW EXECUTE PROCEDURE redirect_revision_append_only();
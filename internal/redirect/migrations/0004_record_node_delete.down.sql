@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS redirect_node_record_delete ON redirect_node;
+DROP FUNCTION IF EXISTS redirect_node_record_delete();
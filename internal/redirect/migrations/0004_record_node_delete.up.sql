@@ -0,0 +1,38 @@
+-- Deleting a node also deletes its children through the cascading foreign key, and bulk
+-- deletes are not tied to a single node, so the database records deletes in the history.
+-- The first node of a subtree records all of its descendants while their paths can still be
+-- resolved, the cascaded deletes of the descendants then find their revision in place.
+CREATE FUNCTION redirect_node_record_delete() RETURNS trigger AS $$
+DECLARE
+    prefix text;
+BEGIN
+    IF EXISTS (SELECT 1 FROM redirect_revision WHERE node_id = OLD.id AND action = 'delete') THEN
+        RETURN OLD;
+    END IF;
+
+    WITH RECURSIVE ancestor (id, parent_id, path) AS (
+        SELECT id, parent_id, '/' || path_segment FROM redirect_node WHERE id = OLD.parent_id
+        UNION ALL
+        SELECT node.id, node.parent_id, '/' || node.path_segment || ancestor.path
+        FROM redirect_node node JOIN ancestor ON node.id = ancestor.parent_id
+    )
+    SELECT path INTO prefix FROM ancestor WHERE parent_id IS NULL;
+
+    WITH RECURSIVE subtree (id, url, path) AS (
+        SELECT OLD.id, OLD.url, COALESCE(prefix, '') || '/' || OLD.path_segment
+        UNION ALL
+        SELECT node.id, node.url, subtree.path || '/' || node.path_segment
+        FROM redirect_node node JOIN subtree ON node.parent_id = subtree.id
+    )
+    INSERT INTO redirect_revision (node_id, path, action, old_url, new_url, actor, client_ip, user_agent, created_at)
+    SELECT id, path, 'delete', url, '', 'unknown', '', '', now() FROM subtree
+    WHERE NOT EXISTS (
+        SELECT 1 FROM redirect_revision WHERE node_id = subtree.id AND action = 'delete'
+    );
+
+    RETURN OLD;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER redirect_node_record_delete BEFORE DELETE ON redirect_node
+    FOR EACH ROW EXECUTE PROCEDURE redirect_node_record_delete();
@@ -1,6 +1,10 @@
 package redirect
 
-import botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+import (
+	"time"
+
+	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+)
 
 // Node is a database model
 type Node struct {
@@ -15,20 +19,67 @@ func (Node) TableName() string {
 	return "redirect_node"
 }
 
+// Revision is a database model recording one change to a Node, rows are never updated or deleted
+type Revision struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	NodeID    uint      `gorm:"not null;index:revision_node_idx" json:"node"`
+	Path      string    `gorm:"not null;index:revision_path_idx" json:"path"`
+	Action    string    `gorm:"not null" json:"action"`
+	OldURL    string    `gorm:"not null" json:"old_url"`
+	NewURL    string    `gorm:"not null" json:"new_url"`
+	Actor     string    `gorm:"not null" json:"actor"`
+	ClientIP  string    `gorm:"not null" json:"-"`
+	UserAgent string    `gorm:"not null" json:"-"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
+
+// TableName returns the name of the table associated with this model
+func (Revision) TableName() string {
+	return "redirect_revision"
+}
+
+// Codes of error responses, they tell errors apart without depending on the wording of the message
+const (
+	CodeChallengeFailed = "challenge_failed"
+	CodeBlocked         = "destination_blocked"
+	CodeLinkExists      = "link_exists"
+	CodeLinkElsewhere   = "link_elsewhere"
+)
+
 // ErrorResponse is a JSON response model
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 // CreateLinkResponse is a JSON response model
 type CreateLinkResponse struct {
 	Shortcut string `json:"shortcut"`
 	Redirect string `json:"redirect"`
+
+	// Existing lists other shortcuts that already redirect to the same URL
+	Existing []string `json:"existing,omitempty"`
+}
+
+// LinkByURLResponse is a JSON response model
+type LinkByURLResponse struct {
+	URL       string   `json:"url"`
+	Shortcuts []string `json:"shortcuts"`
 }
 
 // PostLinkBody is used by a JSON request model
 type PostLinkBody struct {
 	URL  string `json:"url"`
 	Path string `json:"path"`
+
+	// Website is a honeypot field, it is hidden from humans so only bots fill it in
+	Website string `json:"website"`
+
 	botstopper.Response
 }
+
+// RollbackLinkBody is used by a JSON request model
+type RollbackLinkBody struct {
+	Path     string `json:"path"`
+	Revision uint   `json:"revision"`
+}
@@ -1,9 +1,12 @@
 package redirect
 
 import (
+	"context"
+	"database/sql"
+	"embed"
 	"errors"
-	"log"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -11,7 +14,14 @@ import (
 
 	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/blocklist"
 	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+	"github.com/lk16/heyluuk/internal/botscore"
+	"github.com/lk16/heyluuk/internal/clientip"
+	"github.com/lk16/heyluuk/internal/logging"
+	"github.com/lk16/heyluuk/internal/metrics"
+	"github.com/lk16/heyluuk/internal/migrate"
+	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -28,8 +38,18 @@ var (
 	errURLRedirects        = errors.New("URL redirects")
 	errURLStatusCode       = errors.New("URL responds with unexpected status code")
 	errPathInvalidPrefix   = errors.New("Path has invalid prefix")
+	errDestinationBlocked  = errors.New("Destination is blocked")
 
 	pathRegex = regexp.MustCompile("[a-z0-9/-]*")
+
+	// reservedPrefixes are first path segments used by the site itself
+	reservedPrefixes = map[string]struct{}{
+		"api":     {},
+		"static":  {},
+		"metrics": {},
+		"healthz": {},
+		"readyz":  {},
+	}
 )
 
 const (
@@ -38,22 +58,37 @@ const (
 	maxPathLength       = (maxPathDepth * maxSegmentLength) + maxPathDepth
 	linkVerifyUserAgent = "heylu.uk link checker/0.0"
 	linkVerifyTimeout   = time.Second
+
+	// ruleUnparsable is logged as blocklist rule for destinations we cannot tell the host of
+	ruleUnparsable = "unparsable URL"
 )
 
-// Migrate does automatic DB model migrations
+// MigrationComponent identifies the migrations of this package in the schema_migrations table
+const MigrationComponent = "redirect"
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewMigrator returns a Migrator for the versioned schema migrations of this package
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+
+	migrations, err := migrate.Load(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(db, MigrationComponent, migrations), nil
+}
+
+// Migrate applies all pending DB migrations
 func Migrate(db *gorm.DB) error {
 
-	if err := db.AutoMigrate(&Node{}).Error; err != nil {
+	migrator, err := NewMigrator(db.DB())
+	if err != nil {
 		return err
 	}
 
-	err := db.Model(&Node{}).AddForeignKey(
-		"parent_id",               // field
-		Node{}.TableName()+"(id)", // dest
-		"CASCADE",                 // onDelete
-		"RESTRICT",                // onUpdate
-	).Error
-
+	_, err = migrator.Up(context.Background())
 	return err
 }
 
@@ -61,9 +96,32 @@ func Migrate(db *gorm.DB) error {
 type Controller struct {
 	DB         *gorm.DB
 	BotStopper botstopper.Interface
+
+	// BotScorer rejects submissions with too many other bot signals, only the challenge is checked when it is nil
+	BotScorer botscore.Interface
+
+	// Blocklist rejects destinations, nothing is blocked when it is nil
+	Blocklist blocklist.Interface
+
+	// AllowedSchemes restricts destination URLs, DefaultSchemes is used when it is nil
+	AllowedSchemes []string
+
+	// Logger receives all log lines, the standard logrus logger is used when it is nil
+	Logger logrus.FieldLogger
+
+	// AdminToken is required as bearer token for administrative actions, which are disabled when empty
+	AdminToken string
+
+	// APIKeys are bearer tokens of trusted tools, which create links without answering a challenge
+	APIKeys []string
 }
 
-func (cont *Controller) getLink(pathSegments []string) (string, error) {
+// logger returns a log entry for the request of c
+func (cont *Controller) logger(c echo.Context) *logrus.Entry {
+	return logging.Request(cont.Logger, c)
+}
+
+func (cont *Controller) getNode(pathSegments []string) (*Node, error) {
 
 	var node Node
 	var err error
@@ -82,14 +140,24 @@ func (cont *Controller) getLink(pathSegments []string) (string, error) {
 		}
 
 		if gorm.IsRecordNotFoundError(err) {
-			return "", errLinkNotFound
+			return nil, errLinkNotFound
 		}
 
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
+	return &node, nil
+}
+
+func (cont *Controller) getLink(pathSegments []string) (string, error) {
+
+	node, err := cont.getNode(pathSegments)
+	if err != nil {
+		return "", err
+	}
+
 	if node.URL == "" {
 		return "", errEmptyRedirectURL
 	}
@@ -97,6 +165,27 @@ func (cont *Controller) getLink(pathSegments []string) (string, error) {
 	return node.URL, nil
 }
 
+// blockedBy returns the blocklist rule matching the host of a destination URL, or an empty string
+func (cont *Controller) blockedBy(URL string) string {
+
+	if cont.Blocklist == nil {
+		return ""
+	}
+
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		// we cannot tell where this goes, so we don't send anyone there
+		return ruleUnparsable
+	}
+
+	return cont.Blocklist.Match(parsed.Hostname())
+}
+
+// isBlocked checks if the host of a destination URL is on the blocklist
+func (cont *Controller) isBlocked(URL string) bool {
+	return cont.blockedBy(URL) != ""
+}
+
 // Redirect redirects any url in the db
 func (cont *Controller) Redirect(c echo.Context) error {
 
@@ -108,18 +197,42 @@ func (cont *Controller) Redirect(c echo.Context) error {
 	splitPath, err := verifyAndSplitPath(path)
 
 	if err != nil {
-		log.Printf("Error for path %s: %s", path, err.Error())
+		cont.logger(c).WithError(err).Info("invalid shortcut")
+		metrics.Redirects.WithLabelValues("invalid").Inc()
 		return c.Render(http.StatusNotFound, "not_found.html", nil)
 	}
 
-	url, err := cont.getLink(splitPath)
+	URL, err := cont.getLink(splitPath)
 
 	if err != nil {
-		log.Printf("Error for path %s: %s", path, err.Error())
+		if err == errLinkNotFound {
+			cont.logger(c).WithError(err).Info("shortcut not found")
+			metrics.Redirects.WithLabelValues("not_found").Inc()
+		} else {
+			cont.logger(c).WithError(err).Error("shortcut lookup failed")
+			metrics.Redirects.WithLabelValues("error").Inc()
+		}
 		return c.Render(http.StatusNotFound, "not_found.html", nil)
 	}
 
-	return c.Redirect(http.StatusFound, url)
+	if rule := cont.blockedBy(URL); rule != "" {
+		cont.logger(c).WithFields(logrus.Fields{
+			"shortcut": path,
+			"url":      URL,
+			"rule":     rule,
+		}).Warn("shortcut destination is blocked")
+		metrics.Redirects.WithLabelValues("blocked").Inc()
+
+		type dataType struct {
+			URL string
+		}
+
+		data := dataType{URL: URL}
+		return c.Render(http.StatusForbidden, "blocked.html", data)
+	}
+
+	metrics.Redirects.WithLabelValues("hit").Inc()
+	return c.Redirect(http.StatusFound, URL)
 }
 
 // NewLinkGet is a page that handles GET requests to create a new link
@@ -157,7 +270,7 @@ func verifyAndSplitPath(path string) (segments []string, err error) {
 		return nil, errEmptyPath
 	}
 
-	if segments[0] == "static" || segments[0] == "api" {
+	if _, ok := reservedPrefixes[segments[0]]; ok {
 		return nil, errPathInvalidPrefix
 	}
 
@@ -174,12 +287,21 @@ func verifyAndSplitPath(path string) (segments []string, err error) {
 	return segments, nil
 }
 
-func (cont *Controller) insertNewLink(URL string, segments []string) error {
+func (cont *Controller) insertNewLink(URL string, segments []string, a author) error {
 
 	if len(segments) == 0 {
 		return errEmptyPath
 	}
 
+	// nodes are saved together with their revisions, so no change goes unrecorded
+	return cont.DB.Transaction(func(tx *gorm.DB) error {
+		return insertNodes(tx, URL, segments, a)
+	})
+}
+
+// insertNodes creates the nodes of a new link at segments, it runs in a transaction
+func insertNodes(tx *gorm.DB, URL string, segments []string, a author) error {
+
 	var node Node
 	var err error
 
@@ -198,7 +320,7 @@ func (cont *Controller) insertNewLink(URL string, segments []string) error {
 		}
 
 		node = Node{} // reset node to not confuse GORM
-		err = cont.DB.Find(&node, where...).Error
+		err = tx.Find(&node, where...).Error
 
 		if gorm.IsRecordNotFoundError(err) {
 			// Link not found, create it
@@ -209,10 +331,24 @@ func (cont *Controller) insertNewLink(URL string, segments []string) error {
 				node.ParentID = &parentID
 			}
 
-			if err = cont.DB.Create(&node).Error; err != nil {
+			isLeaf := i == len(segments)-1
+			if isLeaf {
+				node.URL = URL
+			}
+
+			if err = tx.Create(&node).Error; err != nil {
+				return err
+			}
+
+			path := joinPath(segments[:i+1])
+			if err = recordRevision(tx, &node, path, revisionCreate, "", node.URL, a); err != nil {
 				return err
 			}
 
+			if isLeaf {
+				return nil
+			}
+
 		} else if err != nil {
 			// DB error
 			return err
@@ -222,7 +358,10 @@ func (cont *Controller) insertNewLink(URL string, segments []string) error {
 	// Node has no link
 	if node.URL == "" {
 		node.URL = URL
-		return cont.DB.Save(&node).Error
+		if err = tx.Save(&node).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, &node, joinPath(segments), revisionUpdate, "", URL, a)
 	}
 
 	// Node has different link
@@ -239,13 +378,26 @@ func (cont *Controller) PostLink(c echo.Context) error {
 
 	body := PostLinkBody{}
 
+	outcome := "invalid_body"
+	defer func() {
+		metrics.LinkCreations.WithLabelValues(outcome).Inc()
+	}()
+
 	if err := c.Bind(&body); err != nil {
-		response := ErrorResponse{err.Error()}
+		response := ErrorResponse{Error: err.Error()}
 		return c.JSON(http.StatusBadRequest, response)
 	}
 
-	if !cont.BotStopper.Verify(body.Response) {
-		response := ErrorResponse{"Anti-bot challenge failed"}
+	body.Response.Client = clientip.Get(c)
+
+	actor := actorAnonymous
+	if cont.hasAPIKey(c) {
+		actor = actorAPI
+	}
+
+	if actor != actorAPI && cont.isBot(c, body) {
+		outcome = "bot"
+		response := ErrorResponse{Error: "Anti-bot challenge failed", Code: CodeChallengeFailed}
 		return c.JSON(http.StatusBadRequest, response)
 	}
 
@@ -256,27 +408,153 @@ func (cont *Controller) PostLink(c echo.Context) error {
 	var segments []string
 	var err error
 	if segments, err = verifyAndSplitPath(body.Path); err != nil {
-		response := ErrorResponse{"Invalid shortcut"}
+		outcome = "invalid_shortcut"
+		response := ErrorResponse{Error: "Invalid shortcut"}
 		return c.JSON(http.StatusBadRequest, response)
 	}
 
-	linkResponse.Shortcut = "/" + strings.Join(segments, "/")
+	linkResponse.Shortcut = joinPath(segments)
 
-	var URL = body.URL
-	if !strings.HasPrefix(URL, "http://") && !strings.HasPrefix(URL, "https://") {
-		URL = "http://" + URL
+	URL, err := normalizeURL(body.URL, cont.AllowedSchemes)
+	if err != nil {
+		outcome = "invalid_url"
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
 	}
 
 	linkResponse.Redirect = URL
 
-	if err = cont.insertNewLink(URL, segments); err != nil {
-		response := ErrorResponse{"Saving new link failed: " + err.Error()}
-		return c.JSON(http.StatusInternalServerError, response)
+	if cont.isBlocked(URL) {
+		outcome = "blocked"
+		response := ErrorResponse{Error: errDestinationBlocked.Error(), Code: CodeBlocked}
+		return c.JSON(http.StatusBadRequest, response)
 	}
 
+	// the lookup only provides a hint, so failing it should not stop link creation
+	if linkResponse.Existing, err = cont.findShortcuts(URL); err != nil {
+		cont.logger(c).WithError(err).Warn("existing shortcut lookup failed")
+	}
+
+	if err = cont.insertNewLink(URL, segments, newAuthor(c, actor)); err != nil {
+		response := ErrorResponse{Error: "Saving new link failed: " + err.Error()}
+		switch err {
+		case errLinkExists:
+			outcome = "link_exists"
+			response.Code = CodeLinkExists
+			return c.JSON(http.StatusConflict, response)
+		case errLinkPointsElsewhere:
+			outcome = "link_points_elsewhere"
+			response.Code = CodeLinkElsewhere
+			return c.JSON(http.StatusConflict, response)
+		default:
+			outcome = "db_error"
+			return c.JSON(http.StatusInternalServerError, response)
+		}
+	}
+
+	outcome = "created"
 	return c.JSON(http.StatusCreated, linkResponse)
 }
 
+// isBot checks the challenge answer and other bot signals of a submission,
+// it logs why a submission is rejected
+func (cont *Controller) isBot(c echo.Context, body PostLinkBody) bool {
+
+	client := body.Response.Client
+
+	if !cont.BotStopper.Verify(body.Response) {
+		if cont.BotScorer != nil {
+			cont.BotScorer.RecordFailure(client)
+		}
+		cont.logger(c).WithField(logging.FieldClientIP, client).Warn("link rejected: wrong challenge answer")
+		return true
+	}
+
+	if cont.BotScorer == nil {
+		return false
+	}
+
+	signals := botscore.Signals{
+		Client:   client,
+		Honeypot: body.Website,
+	}
+
+	// a verified challenge has a valid token, so this only fails when it expired just now
+	if issuedAt, err := cont.BotStopper.IssuedAt(body.Response); err == nil {
+		signals.AnswerTime = time.Since(issuedAt)
+	}
+
+	verdict := cont.BotScorer.Evaluate(signals)
+	if verdict.Rejected {
+		cont.logger(c).WithFields(logrus.Fields{
+			logging.FieldClientIP: client,
+			"score":               verdict.Score,
+			"reasons":             verdict.Reasons,
+		}).Warn("link rejected: bot score too high")
+	}
+
+	return verdict.Rejected
+}
+
+// findShortcuts returns the full paths of all nodes redirecting to URL
+func (cont *Controller) findShortcuts(URL string) ([]string, error) {
+
+	// walk up from every matching node to its root, prepending path segments
+	query := `
+		WITH RECURSIVE paths(parent_id, path) AS (
+			SELECT parent_id, '/' || path_segment
+			FROM ` + Node{}.TableName() + `
+			WHERE url = ? AND url <> ''
+		UNION ALL
+			SELECT parent.parent_id, '/' || parent.path_segment || paths.path
+			FROM paths
+			JOIN ` + Node{}.TableName() + ` parent ON parent.id = paths.parent_id
+		)
+		SELECT path FROM paths WHERE parent_id IS NULL ORDER BY path`
+
+	rows, err := cont.DB.Raw(query, URL).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shortcuts []string
+	for rows.Next() {
+		var shortcut string
+		if err = rows.Scan(&shortcut); err != nil {
+			return nil, err
+		}
+		shortcuts = append(shortcuts, shortcut)
+	}
+
+	return shortcuts, rows.Err()
+}
+
+// GetLinkByURL returns all shortcuts redirecting to the URL in the query
+func (cont *Controller) GetLinkByURL(c echo.Context) error {
+
+	URL, err := normalizeURL(c.QueryParam("url"), cont.AllowedSchemes)
+	if err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	shortcuts, err := cont.findShortcuts(URL)
+	if err != nil {
+		cont.logger(c).WithError(err).Error("shortcut lookup by URL failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+
+	if shortcuts == nil {
+		shortcuts = []string{}
+	}
+
+	response := LinkByURLResponse{
+		URL:       URL,
+		Shortcuts: shortcuts}
+	return c.JSON(http.StatusOK, response)
+}
+
 // GetNode returns a node by ID
 func (cont *Controller) GetNode(c echo.Context) error {
 
@@ -284,7 +562,7 @@ func (cont *Controller) GetNode(c echo.Context) error {
 
 	ID, err := strconv.Atoi(IDString)
 	if err != nil {
-		response := ErrorResponse{"Invalid id parameter"}
+		response := ErrorResponse{Error: "Invalid id parameter"}
 		return c.JSON(http.StatusBadRequest, response)
 	}
 
@@ -296,7 +574,7 @@ func (cont *Controller) GetNode(c echo.Context) error {
 	}
 
 	if err != nil {
-		log.Printf("GetNode error: %s", err.Error())
+		cont.logger(c).WithField(logging.FieldNodeID, ID).WithError(err).Error("getting node failed")
 		return c.JSON(http.StatusInternalServerError, nil)
 	}
 
@@ -324,7 +602,7 @@ func (cont *Controller) GetNodeChildren(c echo.Context) error {
 
 	ID, err := strconv.Atoi(IDString)
 	if err != nil {
-		response := ErrorResponse{"Invalid id parameter"}
+		response := ErrorResponse{Error: "Invalid id parameter"}
 		return c.JSON(http.StatusBadRequest, response)
 	}
 
@@ -333,7 +611,7 @@ func (cont *Controller) GetNodeChildren(c echo.Context) error {
 	err = cont.DB.Find(&nodes, &Node{ParentID: &parentID}).Error
 
 	if err != nil && !gorm.IsRecordNotFoundError(err) {
-		log.Printf("GetNodeChildren error: %s", err.Error())
+		cont.logger(c).WithField(logging.FieldNodeID, ID).WithError(err).Error("getting node children failed")
 		return c.JSON(http.StatusInternalServerError, nil)
 	}
 
@@ -342,5 +620,9 @@ func (cont *Controller) GetNodeChildren(c echo.Context) error {
 
 // GetChallenge generates and returns a new anti-bot challenge
 func (cont *Controller) GetChallenge(c echo.Context) error {
-	return c.JSON(http.StatusOK, cont.BotStopper.GetChallenge())
+	request := botstopper.Request{
+		Client:         clientip.Get(c),
+		AcceptLanguage: c.Request().Header.Get("Accept-Language"),
+	}
+	return c.JSON(http.StatusOK, cont.BotStopper.GetChallenge(request))
 }
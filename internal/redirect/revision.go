@@ -0,0 +1,226 @@
+package redirect
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/auth"
+	"github.com/lk16/heyluuk/internal/clientip"
+)
+
+const (
+	revisionCreate   = "create"
+	revisionUpdate   = "update"
+	revisionDelete   = "delete"
+	revisionRollback = "rollback"
+
+	actorAnonymous = "anonymous"
+	actorAdmin     = "admin"
+	actorAPI       = "api"
+	actorUnknown   = "unknown" // recorded by the delete trigger of redirect_node
+	actorSystem    = "system"
+)
+
+var (
+	errRevisionNotFound = errors.New("Revision not found")
+	errRevisionEmptyURL = errors.New("Revision has no redirect URL")
+	errUnauthorized     = errors.New("Unauthorized")
+)
+
+// author describes who made a change to a link
+type author struct {
+	actor     string
+	clientIP  string
+	userAgent string
+}
+
+func newAuthor(c echo.Context, actor string) author {
+	return author{
+		actor:     actor,
+		clientIP:  clientip.Get(c),
+		userAgent: c.Request().UserAgent(),
+	}
+}
+
+func joinPath(segments []string) string {
+	return "/" + strings.Join(segments, "/")
+}
+
+// recordRevision appends a change of a node to the revision history
+func recordRevision(db *gorm.DB, node *Node, path, action, oldURL, newURL string, a author) error {
+
+	revision := Revision{
+		NodeID:    node.ID,
+		Path:      path,
+		Action:    action,
+		OldURL:    oldURL,
+		NewURL:    newURL,
+		Actor:     a.actor,
+		ClientIP:  a.clientIP,
+		UserAgent: a.userAgent,
+	}
+
+	return db.Create(&revision).Error
+}
+
+// nodePath reconstructs the full path of a node by walking up its parents
+func nodePath(db *gorm.DB, node *Node) (string, error) {
+
+	segments := []string{node.PathSegment}
+	parentID := node.ParentID
+
+	for parentID != nil {
+		var parent Node
+		if err := db.Find(&parent, &Node{ID: *parentID}).Error; err != nil {
+			return "", err
+		}
+
+		segments = append([]string{parent.PathSegment}, segments...)
+		parentID = parent.ParentID
+	}
+
+	return joinPath(segments), nil
+}
+
+// isAdmin checks if the request carries the admin token as bearer token
+func (cont *Controller) isAdmin(c echo.Context) bool {
+	return auth.IsAdmin(c, cont.AdminToken)
+}
+
+// hasAPIKey checks if the request carries one of the API keys as bearer token
+func (cont *Controller) hasAPIKey(c echo.Context) bool {
+
+	token := auth.BearerToken(c)
+	if token == "" {
+		return false
+	}
+
+	for _, key := range cont.APIKeys {
+		if auth.Matches(token, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cont *Controller) rollbackLink(segments []string, revisionID uint, a author) (*Node, error) {
+
+	node, err := cont.getNode(segments)
+	if err != nil {
+		return nil, err
+	}
+
+	path := joinPath(segments)
+
+	var revision Revision
+	err = cont.DB.Where("id = ? AND path = ?", revisionID, path).Find(&revision).Error
+
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, errRevisionNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if revision.NewURL == "" {
+		return nil, errRevisionEmptyURL
+	}
+
+	// the URL was valid when it was saved, but the allowed schemes or the blocklist may have changed
+	URL, err := normalizeURL(revision.NewURL, cont.AllowedSchemes)
+	if err != nil {
+		return nil, err
+	}
+
+	if cont.isBlocked(URL) {
+		return nil, errDestinationBlocked
+	}
+
+	if URL == node.URL {
+		return nil, errLinkExists
+	}
+
+	oldURL := node.URL
+	node.URL = URL
+
+	err = cont.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(node).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, node, path, revisionRollback, oldURL, node.URL, a)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// GetLinkHistory returns all revisions of a path, oldest first
+func (cont *Controller) GetLinkHistory(c echo.Context) error {
+
+	segments, err := verifyAndSplitPath(c.QueryParam("path"))
+	if err != nil {
+		response := ErrorResponse{Error: "Invalid shortcut"}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	var revisions []Revision
+	err = cont.DB.Order("id").Find(&revisions, &Revision{Path: joinPath(segments)}).Error
+
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		cont.logger(c).WithError(err).Error("getting link history failed")
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// PostLinkRollback points a link back to the URL of one of its previous revisions
+func (cont *Controller) PostLinkRollback(c echo.Context) error {
+
+	if !cont.isAdmin(c) {
+		response := ErrorResponse{Error: errUnauthorized.Error()}
+		return c.JSON(http.StatusUnauthorized, response)
+	}
+
+	body := RollbackLinkBody{}
+
+	if err := c.Bind(&body); err != nil {
+		response := ErrorResponse{Error: err.Error()}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	segments, err := verifyAndSplitPath(body.Path)
+	if err != nil {
+		response := ErrorResponse{Error: "Invalid shortcut"}
+		return c.JSON(http.StatusBadRequest, response)
+	}
+
+	node, err := cont.rollbackLink(segments, body.Revision, newAuthor(c, actorAdmin))
+
+	switch err {
+	case nil:
+		linkResponse := CreateLinkResponse{
+			Shortcut: joinPath(segments),
+			Redirect: node.URL}
+		return c.JSON(http.StatusOK, linkResponse)
+	case errLinkNotFound, errRevisionNotFound:
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errDestinationBlocked:
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), Code: CodeBlocked})
+	case errRevisionEmptyURL, errLinkExists:
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errURLInvalid, errURLScheme, errURLUserinfo, errURLHost, errURLPort:
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		response := ErrorResponse{Error: "Rollback failed: " + err.Error()}
+		return c.JSON(http.StatusInternalServerError, response)
+	}
+}
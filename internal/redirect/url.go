@@ -0,0 +1,189 @@
+package redirect
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/net/idna"
+)
+
+var (
+	errURLEmpty    = errors.New("URL is empty")
+	errURLInvalid  = errors.New("URL is malformed")
+	errURLScheme   = errors.New("URL scheme is not allowed")
+	errURLUserinfo = errors.New("URL must not contain a username or password")
+	errURLHost     = errors.New("URL has an invalid host")
+	errURLPort     = errors.New("URL has an invalid port")
+
+	// schemeRegex matches a scheme like "javascript:" but not a port like "example.com:8080"
+	schemeRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:([^0-9]|$)`)
+
+	// DefaultSchemes are the URL schemes allowed when the Controller does not specify any
+	DefaultSchemes = []string{"http", "https"}
+
+	defaultPorts = map[string]string{
+		"http":  "80",
+		"https": "443",
+		"ftp":   "21",
+	}
+)
+
+// normalizeURL validates a destination URL and returns it in canonical form:
+// lowercase scheme and host, IDN hosts in punycode and default ports removed.
+// URLs without scheme are assumed to be http.
+func normalizeURL(raw string, allowedSchemes []string) (string, error) {
+
+	raw = strings.TrimSpace(raw)
+
+	if raw == "" {
+		return "", errURLEmpty
+	}
+
+	if !strings.Contains(raw, "://") && !schemeRegex.MatchString(raw) {
+		raw = "http://" + raw
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", errURLInvalid
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+
+	if !isAllowedScheme(parsed.Scheme, allowedSchemes) {
+		return "", errURLScheme
+	}
+
+	if parsed.Opaque != "" {
+		return "", errURLInvalid
+	}
+
+	if parsed.User != nil {
+		return "", errURLUserinfo
+	}
+
+	host, err := normalizeHost(parsed.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	port := parsed.Port()
+	if port != "" {
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return "", errURLPort
+		}
+
+		if port == defaultPorts[parsed.Scheme] {
+			port = ""
+		}
+	}
+
+	if port != "" {
+		parsed.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		parsed.Host = "[" + host + "]"
+	} else {
+		parsed.Host = host
+	}
+
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+
+	return parsed.String(), nil
+}
+
+func isAllowedScheme(scheme string, allowedSchemes []string) bool {
+
+	if allowedSchemes == nil {
+		allowedSchemes = DefaultSchemes
+	}
+
+	for _, allowed := range allowedSchemes {
+		if scheme == strings.ToLower(strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeHost lowercases a host and converts internationalized domain names to punycode
+func normalizeHost(host string) (string, error) {
+
+	if host == "" {
+		return "", errURLHost
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", errURLHost
+	}
+
+	// reject single-label hosts like "localhost", they don't work for anyone else
+	if !strings.Contains(ascii, ".") {
+		return "", errURLHost
+	}
+
+	return ascii, nil
+}
+
+// NormalizeLinks normalizes the URLs of links created before destinations were normalized, so
+// looking them up by destination finds them. Links whose URL is not valid anymore are skipped.
+// It returns how many links were updated and skipped.
+func NormalizeLinks(db *gorm.DB, allowedSchemes []string) (updated int, skipped int, err error) {
+
+	var nodes []Node
+	if err = db.Where("url <> ''").Order("id").Find(&nodes).Error; err != nil {
+		return 0, 0, err
+	}
+
+	for i := range nodes {
+		node := &nodes[i]
+
+		normalized, err := normalizeURL(node.URL, allowedSchemes)
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		if normalized == node.URL {
+			continue
+		}
+
+		path, err := nodePath(db, node)
+		if err != nil {
+			return updated, skipped, err
+		}
+
+		oldURL := node.URL
+		node.URL = normalized
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(node).Error; err != nil {
+				return err
+			}
+			return recordRevision(tx, node, path, revisionUpdate, oldURL, normalized, author{actor: actorSystem})
+		})
+
+		if err != nil {
+			return updated, skipped, err
+		}
+
+		updated++
+	}
+
+	return updated, skipped, nil
+}
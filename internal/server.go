@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	dbConnectAttempts = 10
+	dbRetryInitial    = 500 * time.Millisecond
+	dbRetryMax        = 10 * time.Second
+)
+
+// Server is the echo server together with the background workers it depends on
+type Server struct {
+	*echo.Echo
+
+	// closers are closed in reverse order after the server is shut down
+	closers []io.Closer
+}
+
+// addCloser registers a background worker or connection to close on shutdown
+func (s *Server) addCloser(closer io.Closer) {
+	s.closers = append(s.closers, closer)
+}
+
+// Shutdown stops accepting requests, waits for the ones in flight until ctx is done
+// and then closes all background workers. It returns the first error encountered.
+func (s *Server) Shutdown(ctx context.Context) error {
+
+	err := s.Echo.Shutdown(ctx)
+
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if closeErr := s.closers[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// retry calls f until it succeeds or attempts run out, doubling the wait between attempts
+// from initial up to max. Failures are logged as task, the last error is returned.
+func retry(task string, attempts int, initial, max time.Duration, f func() error) error {
+
+	wait := initial
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+
+		if err = f(); err == nil {
+			return nil
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"attempt":  attempt,
+			"retry_in": wait.String(),
+		}).Warn(task + " failed, retrying")
+
+		time.Sleep(wait)
+
+		if wait *= 2; wait > max {
+			wait = max
+		}
+	}
+
+	return err
+}
+
+// openDB connects to the database, retrying while it is starting up
+func openDB(dsn string) (*gorm.DB, error) {
+
+	var db *gorm.DB
+
+	err := retry("connecting to database", dbConnectAttempts, dbRetryInitial, dbRetryMax, func() error {
+		var err error
+		db, err = gorm.Open("postgres", dsn)
+		return err
+	})
+
+	return db, err
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+
+	errDummy := errors.New("dummy error")
+
+	t.Run("EventuallySucceeds", func(t *testing.T) {
+		calls := 0
+		err := retry("test", 5, time.Millisecond, time.Millisecond, func() error {
+			calls++
+			if calls < 3 {
+				return errDummy
+			}
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		calls := 0
+		err := retry("test", 3, time.Millisecond, time.Millisecond, func() error {
+			calls++
+			return errDummy
+		})
+
+		assert.Equal(t, errDummy, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		start := time.Now()
+		retry("test", 4, 10*time.Millisecond, 20*time.Millisecond, func() error {
+			return errDummy
+		})
+
+		// waits 10ms, 20ms and 20ms between attempts
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	})
+}
+
+// closeRecorder records the order in which it is closed
+type closeRecorder struct {
+	name   string
+	closed *[]string
+	err    error
+}
+
+func (cr closeRecorder) Close() error {
+	*cr.closed = append(*cr.closed, cr.name)
+	return cr.err
+}
+
+func TestServerShutdown(t *testing.T) {
+
+	errDummy := errors.New("dummy error")
+
+	var closed []string
+	server := &Server{Echo: echo.New()}
+	server.addCloser(closeRecorder{name: "db", closed: &closed})
+	server.addCloser(closeRecorder{name: "blocklist", closed: &closed, err: errDummy})
+	server.addCloser(closeRecorder{name: "other", closed: &closed})
+
+	err := server.Shutdown(context.Background())
+
+	// workers are closed even when one of them fails
+	assert.Equal(t, errDummy, err)
+	assert.Equal(t, []string{"other", "blocklist", "db"}, closed)
+}
@@ -1,58 +1,219 @@
 package internal
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"io/fs"
 	"net/http"
-	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/logging"
+	"github.com/sirupsen/logrus"
 )
 
-const templateRoot = "./web/templates"
+// layoutFile is parsed together with every page template, all other .html files are pages
+const layoutFile = "base.html"
 
+var (
+	errTemplatesMissing = errors.New("templates are not loaded")
+	errTemplateNotFound = errors.New("template not found")
+
+	// renderedTemplates are rendered by handlers outside the page registry
+	renderedTemplates = []string{"not_found.html", "blocked.html"}
+)
+
+// TemplateRenderer renders the page templates in a directory with the layout around them
 type TemplateRenderer struct {
-	templates map[string]*template.Template
+	fsys   fs.FS
+	funcs  template.FuncMap
+	pages  []Page
+	logger logrus.FieldLogger
+
+	// Reload parses the templates again when they change on disk, which is meant for development
+	Reload bool
+
+	// User returns the name of the current user, which is empty for anonymous visitors
+	User func(c echo.Context) string
+
+	mutex       sync.RWMutex
+	templates   map[string]*template.Template
+	fingerprint string
 }
 
-func NewTemplateRenderer() *TemplateRenderer {
+// renderData is passed to every template, Data holds what the handler rendered
+type renderData struct {
+	Title string
+	Nav   []navItem
+	User  string
+	Data  interface{}
+}
+
+// NewTemplateRenderer parses the templates in fsys, funcs are available in all of them
+func NewTemplateRenderer(logger logrus.FieldLogger, fsys fs.FS, funcs template.FuncMap, pages []Page) (*TemplateRenderer, error) {
 
 	t := &TemplateRenderer{
-		templates: make(map[string]*template.Template)}
+		fsys:   fsys,
+		funcs:  funcs,
+		pages:  pages,
+		logger: logger,
+	}
+
+	if err := t.parse(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// fingerprintFiles describes the names, sizes and modification times of the templates in fsys
+func fingerprintFiles(fsys fs.FS) (string, error) {
 
-	files := []string{"index.html", "faq.html", "predictions.html", "new_link.html", "not_found.html", "terms_and_conditions.html"}
+	files, err := fs.Glob(fsys, "*.html")
+	if err != nil {
+		return "", err
+	}
 
+	var builder strings.Builder
 	for _, file := range files {
-		t.templates[file] = template.Must(
-			template.ParseFiles(
-				filepath.Join(templateRoot, file),
-				filepath.Join(templateRoot, "base.html")))
+		info, err := fs.Stat(fsys, file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&builder, "%s:%d:%d\n", file, info.Size(), info.ModTime().UnixNano())
 	}
 
-	return t
+	return builder.String(), nil
 }
 
+// parse discovers and parses all page templates, on failure the previous templates stay active
+func (t *TemplateRenderer) parse() error {
+
+	fingerprint, err := fingerprintFiles(t.fsys)
+	if err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(t.fsys, "*.html")
+	if err != nil {
+		return err
+	}
+
+	templates := make(map[string]*template.Template)
+
+	for _, file := range files {
+		if file == layoutFile {
+			continue
+		}
+
+		parsed, err := template.New(file).Funcs(t.funcs).ParseFS(t.fsys, file, layoutFile)
+		if err != nil {
+			return err
+		}
+		templates[file] = parsed
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.templates = templates
+	t.fingerprint = fingerprint
+	return nil
+}
+
+// reloadIfChanged parses the templates again when any of them changed since they were parsed
+func (t *TemplateRenderer) reloadIfChanged() error {
+
+	fingerprint, err := fingerprintFiles(t.fsys)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.RLock()
+	changed := fingerprint != t.fingerprint
+	t.mutex.RUnlock()
+
+	if !changed {
+		return nil
+	}
+
+	return t.parse()
+}
+
+// page returns the registered page rendered by template
+func (t *TemplateRenderer) page(template string) Page {
+	for _, page := range t.pages {
+		if page.Template == template {
+			return page
+		}
+	}
+	return Page{Template: template}
+}
+
+// Render renders the template called name inside the layout, data is available as .Data
 func (t *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+
+	logger := logging.Request(t.logger, c).WithField("template", name)
+
+	if t.Reload {
+		if err := t.reloadIfChanged(); err != nil {
+			logger.WithError(err).Error("reloading templates failed")
+			return err
+		}
+	}
+
+	t.mutex.RLock()
 	template, ok := t.templates[name]
+	t.mutex.RUnlock()
+
 	if !ok {
-		return errors.New("template not found")
+		return errTemplateNotFound
+	}
+
+	wrapped := renderData{
+		Title: t.page(name).Title,
+		Nav:   navigation(t.pages, name),
+		Data:  data,
+	}
+
+	if t.User != nil {
+		wrapped.User = t.User(c)
 	}
 
-	err := template.ExecuteTemplate(w, "base", data)
+	err := template.ExecuteTemplate(w, "base", wrapped)
 	if err != nil {
-		log.Printf("template rendering error: %s", err.Error())
+		logger.WithError(err).Error("template rendering failed")
 	}
 	return err
 }
 
-type renderData struct {
+// Check is a readiness check returning an error when a template is missing
+func (t *TemplateRenderer) Check(ctx context.Context) error {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	required := append([]string{}, renderedTemplates...)
+	for _, page := range t.pages {
+		if page.Template != "" {
+			required = append(required, page.Template)
+		}
+	}
+
+	for _, file := range required {
+		if _, ok := t.templates[file]; !ok {
+			return fmt.Errorf("%s: %w", file, errTemplatesMissing)
+		}
+	}
+	return nil
 }
 
 func renderTemplateView(templateName string) func(c echo.Context) error {
 	return func(c echo.Context) error {
-		data := renderData{}
-		return c.Render(http.StatusOK, templateName, data)
+		return c.Render(http.StatusOK, templateName, nil)
 	}
 }
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal/assets"
+	"github.com/lk16/heyluuk/web"
+	"github.com/stretchr/testify/assert"
+)
+
+const testLayout = `{{ define "base" }}{{ .Title }}|{{ range .Nav }}{{ if .Active }}*{{ end }}{{ .Label }} {{ end }}|{{ .User }}|{{ template "content" . }}{{ end }}`
+
+// testContext returns a context for a GET request and its recorder
+func testContext() (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec), rec
+}
+
+func TestTemplateRenderer(t *testing.T) {
+
+	templatesFS, err := fs.Sub(web.FS(""), "templates")
+	assert.Nil(t, err)
+
+	staticFS, err := fs.Sub(web.FS(""), "static")
+	assert.Nil(t, err)
+
+	static, err := assets.New(staticFS)
+	assert.Nil(t, err)
+
+	renderer, err := NewTemplateRenderer(nil, templatesFS, template.FuncMap{"static": static.URL}, pages)
+	assert.Nil(t, err)
+	assert.Nil(t, renderer.Check(context.Background()))
+
+	c, _ := testContext()
+
+	// the predictions page needs data of the predictions package
+	for _, file := range []string{"index.html", "faq.html", "new_link.html", "api_docs.html", "prediction_stats.html", "not_found.html"} {
+		t.Run(file, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.Nil(t, renderer.Render(&buf, file, nil, c))
+			assert.Contains(t, buf.String(), static.URL("style.css"))
+		})
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, renderer.Render(&buf, "faq.html", nil, c))
+	assert.Contains(t, buf.String(), "<title>F.A.Q. | Hey Luuk</title>")
+	assert.Contains(t, buf.String(), `<li class="active">
+            <a href="/at/my/faq">F.A.Q.</a>`)
+
+	assert.Equal(t, errTemplateNotFound, renderer.Render(&buf, "missing.html", nil, c))
+}
+
+func TestTemplateRendererData(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"base.html":  {Data: []byte(testLayout)},
+		"page.html":  {Data: []byte(`{{ define "content" }}{{ .Data }}{{ end }}`)},
+		"other.html": {Data: []byte(`{{ define "content" }}other{{ end }}`)},
+	}
+
+	testPages := []Page{
+		{Path: "/page", Template: "page.html", Title: "Page", Nav: "Page"},
+		{Path: "/sub", Template: "other.html", Section: "/page"},
+		{Path: "/elsewhere", Nav: "Elsewhere"},
+	}
+
+	renderer, err := NewTemplateRenderer(nil, fsys, nil, testPages)
+	assert.Nil(t, err)
+
+	render := func(c echo.Context, name string, data interface{}) string {
+		var buf bytes.Buffer
+		assert.Nil(t, renderer.Render(&buf, name, data, c))
+		return buf.String()
+	}
+
+	c, _ := testContext()
+	assert.Equal(t, "Page|*Page Elsewhere ||data", render(c, "page.html", "data"))
+	assert.Equal(t, "|*Page Elsewhere ||other", render(c, "other.html", nil))
+
+	t.Run("User", func(t *testing.T) {
+		renderer.User = func(c echo.Context) string { return "admin" }
+		defer func() { renderer.User = nil }()
+
+		c, _ := testContext()
+		assert.Equal(t, "|*Page Elsewhere |admin|other", render(c, "other.html", nil))
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		assert.True(t, errors.Is(renderer.Check(context.Background()), errTemplatesMissing), "not_found.html is missing")
+	})
+}
+
+func TestTemplateRendererReload(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"base.html": {Data: []byte(`{{ define "base" }}{{ template "content" . }}{{ end }}`)},
+		"page.html": {Data: []byte(`{{ define "content" }}old{{ end }}`)},
+	}
+
+	renderer, err := NewTemplateRenderer(nil, fsys, nil, nil)
+	assert.Nil(t, err)
+
+	render := func() (string, error) {
+		c, _ := testContext()
+		var buf bytes.Buffer
+		err := renderer.Render(&buf, "page.html", nil, c)
+		return buf.String(), err
+	}
+
+	fsys["page.html"] = &fstest.MapFile{Data: []byte(`{{ define "content" }}new{{ end }}`), ModTime: time.Now()}
+	fsys["added.html"] = &fstest.MapFile{Data: []byte(`{{ define "content" }}added{{ end }}`)}
+
+	output, err := render()
+	assert.Nil(t, err)
+	assert.Equal(t, "old", output, "templates are only parsed again with Reload")
+
+	renderer.Reload = true
+
+	output, err = render()
+	assert.Nil(t, err)
+	assert.Equal(t, "new", output)
+
+	c, _ := testContext()
+	var buf bytes.Buffer
+	assert.Nil(t, renderer.Render(&buf, "added.html", nil, c), "new templates are discovered")
+
+	fsys["page.html"] = &fstest.MapFile{Data: []byte(`{{ define "content" }}{{ end `), ModTime: time.Now().Add(time.Second)}
+
+	_, err = render()
+	assert.NotNil(t, err)
+
+	_, err = NewTemplateRenderer(nil, fsys, nil, nil)
+	assert.NotNil(t, err)
+}
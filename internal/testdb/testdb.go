@@ -0,0 +1,68 @@
+// Package testdb connects tests to the database of docker-compose-test.yml
+package testdb
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+
+	_ "github.com/jinzhu/gorm/dialects/postgres" // db driver
+)
+
+// Host is the test database service in docker-compose-test.yml
+const Host = "test_db"
+
+// DSN returns the data source name of the test database
+func DSN() string {
+	return fmt.Sprintf("host=%s sslmode=disable user=%s password=%s dbname=%s", Host,
+		os.Getenv("POSTGRES_TEST_USER"), os.Getenv("POSTGRES_TEST_PASSWORD"), os.Getenv("POSTGRES_TEST_DB"))
+}
+
+// Required checks if tests must fail instead of being skipped without test database,
+// which TEST_DB enables in docker-compose-test.yml
+func Required() bool {
+	required, _ := strconv.ParseBool(os.Getenv("TEST_DB"))
+	return required
+}
+
+// unreachable skips or fails a test which needs the test database
+func unreachable(t testing.TB, err error) {
+	t.Helper()
+	if Required() {
+		t.Fatalf("test database not reachable: %s", err.Error())
+	}
+	t.Skipf("test database not reachable: %s", err.Error())
+}
+
+// Open connects to the test database
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("postgres", DSN())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		unreachable(t, err)
+	}
+
+	return db
+}
+
+// OpenGorm connects to the test database with gorm
+func OpenGorm(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open("postgres", DSN())
+	if err != nil {
+		unreachable(t, err)
+	}
+
+	return db
+}
@@ -0,0 +1,23 @@
+package testdb
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDSN(t *testing.T) {
+	assert.True(t, strings.HasPrefix(DSN(), "host=test_db sslmode=disable "))
+}
+
+func TestRequired(t *testing.T) {
+
+	defer os.Setenv("TEST_DB", os.Getenv("TEST_DB"))
+
+	for value, expected := range map[string]bool{"": false, "0": false, "false": false, "1": true, "true": true} {
+		os.Setenv("TEST_DB", value)
+		assert.Equal(t, expected, Required(), value)
+	}
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/lk16/heyluuk/internal/predictions"
+)
+
+const verifyLogUsage = `usage: heyluuk verify-log [-head HASH] FILE
+
+Checks a prediction log exported from /api/prediction/log, FILE is - for stdin.
+With -head it also checks that a previously published head hash is part of the log.`
+
+var errVerifyLogUsage = errors.New(verifyLogUsage)
+
+// RunVerifyLog checks an exported prediction log, it needs no database or server
+func RunVerifyLog(args []string, stdin io.Reader, out io.Writer) error {
+
+	flags := flag.NewFlagSet("verify-log", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	head := flags.String("head", "", "previously published head hash")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errVerifyLogUsage
+	}
+
+	in := stdin
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	verifier, err := predictions.VerifyLog(in)
+	if err != nil {
+		return err
+	}
+
+	if *head != "" {
+		if err = verifier.Contains(*head); err != nil {
+			return fmt.Errorf("%s: %w", *head, err)
+		}
+	}
+
+	fmt.Fprintf(out, "log is valid, head %d %s\n", verifier.Head().Seq, verifier.Head().Hash)
+	return nil
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lk16/heyluuk/internal/predictions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunVerifyLog(t *testing.T) {
+
+	data := `{"prediction_id":1,"commitment":"` + predictions.Commit("rain", "salt") + `"}`
+	hash := predictions.EntryHash(predictions.GenesisHash, predictions.DataHash(data))
+	export := `{"seq":1,"kind":"commit","prediction_id":1,"data":` + strconv.Quote(data) +
+		`,"prev_hash":"` + predictions.GenesisHash + `","hash":"` + hash + `"}` + "\n"
+
+	t.Run("Usage", func(t *testing.T) {
+		for _, args := range [][]string{{}, {"a", "b"}, {"-unknown", "a"}} {
+			err := RunVerifyLog(args, strings.NewReader(""), &bytes.Buffer{})
+			assert.Equal(t, errVerifyLogUsage, err, args)
+		}
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		var out bytes.Buffer
+		err := RunVerifyLog([]string{"-head", hash, "-"}, strings.NewReader(export), &out)
+		assert.Nil(t, err)
+		assert.Equal(t, "log is valid, head 1 "+hash+"\n", out.String())
+	})
+
+	t.Run("UnknownHead", func(t *testing.T) {
+		err := RunVerifyLog([]string{"-head", "abc", "-"}, strings.NewReader(export), &bytes.Buffer{})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := strings.Replace(export, predictions.Commit("rain", "salt"), predictions.Commit("snow", "salt"), 1)
+		err := RunVerifyLog([]string{"-"}, strings.NewReader(tampered), &bytes.Buffer{})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		err := RunVerifyLog([]string{"/nonexistent"}, strings.NewReader(""), &bytes.Buffer{})
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+}
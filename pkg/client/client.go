@@ -0,0 +1,331 @@
+// Package client is a Go client for the heyluuk API, see /api/openapi.json of a server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of one heyluuk server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	adminToken string
+	solver     Solver
+}
+
+// Interface is the external interface of the Client
+type Interface interface {
+	Challenge(ctx context.Context, languages string) (*Challenge, error)
+	CreateLink(ctx context.Context, path, URL string) (*Link, error)
+	CreateLinkWithAnswer(ctx context.Context, path, URL, challengeID, answer string) (*Link, error)
+	Resolve(ctx context.Context, path string) (string, error)
+	LinksByURL(ctx context.Context, URL string) (*LinksByURL, error)
+	History(ctx context.Context, path string) ([]Revision, error)
+	Rollback(ctx context.Context, path string, revision uint) (*Link, error)
+	RootNodes(ctx context.Context) ([]Node, error)
+	Node(ctx context.Context, ID uint) (*Node, error)
+	Children(ctx context.Context, ID uint) ([]Node, error)
+}
+
+var _ Interface = (*Client)(nil)
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient makes the Client send requests with httpClient instead of http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey makes the Client create links with an API key instead of answering challenges
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithAdminToken sets the token needed for administrative actions like Rollback
+func WithAdminToken(token string) Option {
+	return func(c *Client) {
+		c.adminToken = token
+	}
+}
+
+// WithSolver sets how CreateLink answers challenges, SolveAutomatically is used by default
+func WithSolver(solver Solver) Option {
+	return func(c *Client) {
+		c.solver = solver
+	}
+}
+
+// New returns a Client for the server at baseURL, like https://heylu.uk
+func New(baseURL string, options ...Option) *Client {
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		solver:     SolveAutomatically,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// newRequest builds a request for path relative to the base URL with an optional JSON body
+func (c *Client) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	return req, nil
+}
+
+// do sends req and decodes a JSON response into result, error responses are returned as *Error
+func (c *Client) do(req *http.Request, result interface{}) error {
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newError(resp)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// newError reads an error response
+func newError(resp *http.Response) *Error {
+
+	e := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+
+	var body errorResponse
+	if content, err := ioutil.ReadAll(resp.Body); err == nil && json.Unmarshal(content, &body) == nil && body.Error != "" {
+		e.Message = body.Error
+		e.Code = body.Code
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return e
+}
+
+// get sends a GET request for path and decodes the response into result
+func (c *Client) get(ctx context.Context, path string, result interface{}) error {
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.do(req, result)
+}
+
+// Challenge fetches a new anti-bot challenge, languages is sent as Accept-Language when not empty
+func (c *Client) Challenge(ctx context.Context, languages string) (*Challenge, error) {
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/challenge", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if languages != "" {
+		req.Header.Set("Accept-Language", languages)
+	}
+
+	var challenge Challenge
+	if err = c.do(req, &challenge); err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// CreateLink creates a shortcut at path redirecting to URL. Without an API key it fetches
+// a challenge and answers it with the solver of the Client.
+func (c *Client) CreateLink(ctx context.Context, path, URL string) (*Link, error) {
+
+	if c.apiKey != "" {
+		return c.postLink(ctx, postLinkBody{URL: URL, Path: path})
+	}
+
+	challenge, err := c.Challenge(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	answer, err := c.solver(ctx, *challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.CreateLinkWithAnswer(ctx, path, URL, challenge.ID, answer)
+}
+
+// CreateLinkWithAnswer creates a shortcut at path redirecting to URL with the answer to a challenge
+func (c *Client) CreateLinkWithAnswer(ctx context.Context, path, URL, challengeID, answer string) (*Link, error) {
+	return c.postLink(ctx, postLinkBody{
+		URL:             URL,
+		Path:            path,
+		ChallengeID:     challengeID,
+		ChallengeAnswer: answer,
+	})
+}
+
+func (c *Client) postLink(ctx context.Context, body postLinkBody) (*Link, error) {
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/api/link", body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	var link Link
+	if err = c.do(req, &link); err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// Resolve returns the URL the shortcut at path redirects to
+func (c *Client) Resolve(ctx context.Context, path string) (string, error) {
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+
+	// we want the redirect itself, not wherever it leads
+	httpClient := *c.httpClient
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return "", &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+
+	return resp.Header.Get("Location"), nil
+}
+
+// LinksByURL returns the shortcuts redirecting to URL
+func (c *Client) LinksByURL(ctx context.Context, URL string) (*LinksByURL, error) {
+
+	var links LinksByURL
+	if err := c.get(ctx, "/api/link/by-url?"+url.Values{"url": {URL}}.Encode(), &links); err != nil {
+		return nil, err
+	}
+
+	return &links, nil
+}
+
+// History returns the revisions of the shortcut at path, oldest first
+func (c *Client) History(ctx context.Context, path string) ([]Revision, error) {
+
+	var revisions []Revision
+	if err := c.get(ctx, "/api/link/history?"+url.Values{"path": {path}}.Encode(), &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Rollback points the shortcut at path back to the URL of one of its revisions, it needs an admin token
+func (c *Client) Rollback(ctx context.Context, path string, revision uint) (*Link, error) {
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/api/link/rollback", rollbackLinkBody{Path: path, Revision: revision})
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.adminToken)
+
+	var link Link
+	if err = c.do(req, &link); err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// RootNodes returns the nodes without parent
+func (c *Client) RootNodes(ctx context.Context) ([]Node, error) {
+
+	var nodes []Node
+	if err := c.get(ctx, "/api/node/root", &nodes); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+// Node returns the node with ID
+func (c *Client) Node(ctx context.Context, ID uint) (*Node, error) {
+
+	var node Node
+	if err := c.get(ctx, "/api/node/"+strconv.FormatUint(uint64(ID), 10), &node); err != nil {
+		return nil, err
+	}
+
+	return &node, nil
+}
+
+// Children returns the child nodes of the node with ID
+func (c *Client) Children(ctx context.Context, ID uint) ([]Node, error) {
+
+	var nodes []Node
+	if err := c.get(ctx, "/api/node/"+strconv.FormatUint(uint64(ID), 10)+"/children", &nodes); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
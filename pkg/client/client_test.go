@@ -0,0 +1,312 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo/v4"
+	"github.com/lk16/heyluuk/internal"
+	"github.com/lk16/heyluuk/internal/blocklist"
+	botstopper "github.com/lk16/heyluuk/internal/bot_stopper"
+	"github.com/lk16/heyluuk/internal/predictions"
+	"github.com/lk16/heyluuk/internal/redirect"
+	"github.com/lk16/heyluuk/internal/testdb"
+	"github.com/stretchr/testify/assert"
+)
+
+// nameRenderer renders the template name, so pages work without the template files
+type nameRenderer struct{}
+
+func (nameRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	_, err := io.WriteString(w, name)
+	return err
+}
+
+// testServer runs the real handlers, with db as database
+func testServer(db *gorm.DB) (*httptest.Server, *redirect.Controller) {
+
+	controller := &redirect.Controller{
+		DB:         db,
+		BotStopper: botstopper.NewBotStopper([]byte("secret"), botstopper.Arithmetic{}),
+		AdminToken: "admin",
+		APIKeys:    []string{"key"},
+	}
+
+	e := echo.New()
+	e.Renderer = nameRenderer{}
+	internal.RegisterAPIRoutes(e, controller, &predictions.Controller{DB: db})
+	e.GET("/*", controller.Redirect)
+
+	return httptest.NewServer(e), controller
+}
+
+// testDB connects to the test database and applies the migrations of the server
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.OpenGorm(t)
+	assert.Nil(t, redirect.Migrate(db))
+	return db
+}
+
+func TestSolveArithmetic(t *testing.T) {
+
+	ctx := context.Background()
+
+	for question, expected := range map[string]string{"3+4=": "7", "9-2=": "7", "3x4=": "12", "12/4=": "3"} {
+		answer, err := SolveArithmetic(ctx, Challenge{Kind: KindArithmetic, Question: question})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, answer, question)
+	}
+
+	_, err := SolveArithmetic(ctx, Challenge{Kind: KindArithmetic, Question: "What color is the sky?"})
+	assert.Equal(t, ErrUnsolvable, err)
+
+	_, err = SolveArithmetic(ctx, Challenge{Kind: KindProofOfWork})
+	assert.Equal(t, ErrUnsolvable, err)
+}
+
+func TestSolveProofOfWork(t *testing.T) {
+
+	pow := botstopper.NewProofOfWork(botstopper.ProofOfWorkConfig{
+		BaseDifficulty: 8,
+		MaxDifficulty:  8,
+		SpikeThreshold: 100,
+		Expiry:         botstopper.DefaultProofOfWorkConfig.Expiry,
+	}, []byte("secret"))
+
+	issued := pow.GetChallenge(botstopper.Request{Client: "192.0.2.1"})
+	challenge := Challenge{ID: issued.ID, Question: issued.Question, Kind: issued.Kind, Difficulty: issued.Difficulty}
+
+	answer, err := SolveAutomatically(context.Background(), challenge)
+	assert.Nil(t, err)
+	assert.True(t, pow.Verify(botstopper.Response{ID: challenge.ID, Answer: answer, Client: "192.0.2.1"}))
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		challenge.Difficulty = 256
+		_, err := SolveProofOfWork(ctx, challenge)
+		assert.Equal(t, context.Canceled, err)
+	})
+}
+
+func TestError(t *testing.T) {
+
+	err := error(&Error{StatusCode: http.StatusBadRequest, Message: "Anti-bot challenge failed", Code: codeChallengeFailed})
+	assert.True(t, errors.Is(err, ErrChallengeFailed))
+	assert.True(t, errors.Is(err, ErrBadRequest))
+	assert.False(t, errors.Is(err, ErrNotFound))
+
+	// errors are told apart by their code, not the wording of the message
+	err = &Error{StatusCode: http.StatusBadRequest, Message: "Anti-bot challenge failed"}
+	assert.False(t, errors.Is(err, ErrChallengeFailed))
+
+	err = &Error{StatusCode: http.StatusBadGateway}
+	assert.True(t, errors.Is(err, ErrServer))
+
+	err = &Error{StatusCode: http.StatusBadRequest, Message: "Destination is blocked", Code: codeBlocked}
+	assert.True(t, errors.Is(err, ErrBlocked))
+	assert.True(t, errors.Is(err, ErrBadRequest))
+
+	err = &Error{StatusCode: http.StatusForbidden}
+	assert.True(t, errors.Is(err, ErrBlocked))
+
+	err = &Error{StatusCode: http.StatusConflict, Message: "Link was taken", Code: codeLinkExists}
+	assert.True(t, errors.Is(err, ErrLinkExists))
+	assert.False(t, errors.Is(err, ErrLinkElsewhere))
+	assert.False(t, errors.Is(err, ErrServer))
+
+	err = &Error{StatusCode: http.StatusConflict, Code: codeLinkElsewhere}
+	assert.True(t, errors.Is(err, ErrLinkElsewhere))
+	assert.False(t, errors.Is(err, ErrLinkExists))
+
+	// a real server error is never a conflict
+	err = &Error{StatusCode: http.StatusInternalServerError, Message: "Saving new link failed: Link exists already"}
+	assert.True(t, errors.Is(err, ErrServer))
+	assert.False(t, errors.Is(err, ErrLinkExists))
+}
+
+func TestClientChallenge(t *testing.T) {
+
+	server, _ := testServer(nil)
+	defer server.Close()
+
+	c := New(server.URL)
+	ctx := context.Background()
+
+	challenge, err := c.Challenge(ctx, "nl")
+	assert.Nil(t, err)
+	assert.Equal(t, KindArithmetic, challenge.Kind)
+	assert.NotEmpty(t, challenge.ID)
+
+	t.Run("WrongAnswer", func(t *testing.T) {
+		wrong := New(server.URL, WithSolver(func(context.Context, Challenge) (string, error) {
+			return "wrong", nil
+		}))
+
+		_, err := wrong.CreateLink(ctx, "a", "http://example.com/")
+		assert.True(t, errors.Is(err, ErrChallengeFailed))
+
+		var clientErr *Error
+		assert.True(t, errors.As(err, &clientErr))
+		assert.Equal(t, http.StatusBadRequest, clientErr.StatusCode)
+	})
+
+	t.Run("SolverError", func(t *testing.T) {
+		failing := New(server.URL, WithSolver(func(context.Context, Challenge) (string, error) {
+			return "", ErrUnsolvable
+		}))
+
+		_, err := failing.CreateLink(ctx, "a", "http://example.com/")
+		assert.Equal(t, ErrUnsolvable, err)
+	})
+
+	t.Run("InvalidShortcut", func(t *testing.T) {
+		_, err := c.History(ctx, "api/link")
+		assert.True(t, errors.Is(err, ErrBadRequest))
+		assert.Equal(t, "Invalid shortcut", err.(*Error).Message)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		_, err := New(server.URL, WithAdminToken("wrong")).Rollback(ctx, "a", 1)
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+	})
+
+	t.Run("Blocked", func(t *testing.T) {
+		var blocker blocklist.MockBlocklist
+		blocker.On("Match", "example.com").Return("example.com")
+
+		server, controller := testServer(nil)
+		defer server.Close()
+		controller.Blocklist = &blocker
+
+		_, err := New(server.URL, WithAPIKey("key")).CreateLink(ctx, "a", "http://example.com/")
+		assert.True(t, errors.Is(err, ErrBlocked))
+		assert.False(t, errors.Is(err, ErrServer))
+	})
+
+	t.Run("TooManyRequests", func(t *testing.T) {
+		os.Setenv("RATE_LIMIT_CHALLENGE", "1/m")
+		defer os.Unsetenv("RATE_LIMIT_CHALLENGE")
+
+		server, _ := testServer(nil)
+		defer server.Close()
+
+		c := New(server.URL)
+		_, err := c.Challenge(ctx, "")
+		assert.Nil(t, err)
+
+		_, err = c.Challenge(ctx, "")
+		assert.True(t, errors.Is(err, ErrTooManyRequests))
+		assert.NotZero(t, err.(*Error).RetryAfter)
+	})
+}
+
+func TestClientLinks(t *testing.T) {
+
+	db := testDB(t)
+	defer db.Close()
+
+	server, _ := testServer(db)
+	defer server.Close()
+
+	// clean up after this test finishes, deleting nodes records revisions
+	defer func() {
+		db.Delete(&redirect.Node{})
+		db.Exec("TRUNCATE " + redirect.Revision{}.TableName())
+	}()
+
+	ctx := context.Background()
+	c := New(server.URL)
+
+	link, err := c.CreateLink(ctx, "client/test", "example.com/client")
+	assert.Nil(t, err)
+	assert.Equal(t, &Link{Shortcut: "/client/test", Redirect: "http://example.com/client"}, link)
+
+	t.Run("Resolve", func(t *testing.T) {
+		URL, err := c.Resolve(ctx, "/client/test")
+		assert.Nil(t, err)
+		assert.Equal(t, "http://example.com/client", URL)
+
+		_, err = c.Resolve(ctx, "/client/missing")
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+
+	t.Run("APIKey", func(t *testing.T) {
+		link, err := New(server.URL, WithAPIKey("key")).CreateLink(ctx, "client/key", "example.com/client")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"/client/test"}, link.Existing)
+
+		history, err := c.History(ctx, "client/key")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(history))
+		assert.Equal(t, "api", history[0].Actor)
+	})
+
+	t.Run("LinksByURL", func(t *testing.T) {
+		links, err := c.LinksByURL(ctx, "http://example.com/client")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"/client/key", "/client/test"}, links.Shortcuts)
+	})
+
+	t.Run("Nodes", func(t *testing.T) {
+		roots, err := c.RootNodes(ctx)
+		assert.Nil(t, err)
+
+		var root *Node
+		for i := range roots {
+			if roots[i].PathSegment == "client" {
+				root = &roots[i]
+			}
+		}
+		assert.NotNil(t, root)
+
+		node, err := c.Node(ctx, root.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, root, node)
+
+		children, err := c.Children(ctx, root.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(children))
+
+		_, err = c.Node(ctx, 0)
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		history, err := c.History(ctx, "client/test")
+		assert.Nil(t, err)
+
+		link, err := New(server.URL, WithAdminToken("admin")).Rollback(ctx, "client/test", history[0].ID)
+		assert.True(t, errors.Is(err, ErrBadRequest), "restoring the current URL is rejected")
+		assert.Nil(t, link)
+	})
+
+	t.Run("LinkExists", func(t *testing.T) {
+		_, err := c.CreateLink(ctx, "client/test", "example.com/client")
+		assert.True(t, errors.Is(err, ErrLinkExists))
+		assert.False(t, errors.Is(err, ErrServer))
+
+		_, err = c.CreateLink(ctx, "client/test", "example.com/other")
+		assert.True(t, errors.Is(err, ErrLinkElsewhere))
+		assert.False(t, errors.Is(err, ErrLinkExists))
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		broken := db.New()
+		broken.AddError(errors.New("broken"))
+
+		server, _ := testServer(broken)
+		defer server.Close()
+
+		_, err := New(server.URL).RootNodes(ctx)
+		assert.True(t, errors.Is(err, ErrServer))
+	})
+}
@@ -0,0 +1,85 @@
+// Package clienttest provides a mock of the heyluuk client for tests of code using it
+package clienttest
+
+import (
+	"context"
+
+	"github.com/lk16/heyluuk/pkg/client"
+	"github.com/stretchr/testify/mock"
+)
+
+var _ client.Interface = (*MockClient)(nil)
+
+// MockClient is a struct for testing code using the Client
+type MockClient struct {
+	mock.Mock
+}
+
+// Challenge mocks fetching a challenge
+func (mc *MockClient) Challenge(ctx context.Context, languages string) (*client.Challenge, error) {
+	args := mc.Called(ctx, languages)
+	challenge, _ := args.Get(0).(*client.Challenge)
+	return challenge, args.Error(1)
+}
+
+// CreateLink mocks creating a link
+func (mc *MockClient) CreateLink(ctx context.Context, path, URL string) (*client.Link, error) {
+	args := mc.Called(ctx, path, URL)
+	link, _ := args.Get(0).(*client.Link)
+	return link, args.Error(1)
+}
+
+// CreateLinkWithAnswer mocks creating a link with a challenge answer
+func (mc *MockClient) CreateLinkWithAnswer(ctx context.Context, path, URL, challengeID, answer string) (*client.Link, error) {
+	args := mc.Called(ctx, path, URL, challengeID, answer)
+	link, _ := args.Get(0).(*client.Link)
+	return link, args.Error(1)
+}
+
+// Resolve mocks resolving a shortcut
+func (mc *MockClient) Resolve(ctx context.Context, path string) (string, error) {
+	args := mc.Called(ctx, path)
+	return args.String(0), args.Error(1)
+}
+
+// LinksByURL mocks looking up shortcuts by destination
+func (mc *MockClient) LinksByURL(ctx context.Context, URL string) (*client.LinksByURL, error) {
+	args := mc.Called(ctx, URL)
+	links, _ := args.Get(0).(*client.LinksByURL)
+	return links, args.Error(1)
+}
+
+// History mocks listing revisions
+func (mc *MockClient) History(ctx context.Context, path string) ([]client.Revision, error) {
+	args := mc.Called(ctx, path)
+	revisions, _ := args.Get(0).([]client.Revision)
+	return revisions, args.Error(1)
+}
+
+// Rollback mocks restoring a revision
+func (mc *MockClient) Rollback(ctx context.Context, path string, revision uint) (*client.Link, error) {
+	args := mc.Called(ctx, path, revision)
+	link, _ := args.Get(0).(*client.Link)
+	return link, args.Error(1)
+}
+
+// RootNodes mocks listing root nodes
+func (mc *MockClient) RootNodes(ctx context.Context) ([]client.Node, error) {
+	args := mc.Called(ctx)
+	nodes, _ := args.Get(0).([]client.Node)
+	return nodes, args.Error(1)
+}
+
+// Node mocks getting a node
+func (mc *MockClient) Node(ctx context.Context, ID uint) (*client.Node, error) {
+	args := mc.Called(ctx, ID)
+	node, _ := args.Get(0).(*client.Node)
+	return node, args.Error(1)
+}
+
+// Children mocks listing child nodes
+func (mc *MockClient) Children(ctx context.Context, ID uint) ([]client.Node, error) {
+	args := mc.Called(ctx, ID)
+	nodes, _ := args.Get(0).([]client.Node)
+	return nodes, args.Error(1)
+}
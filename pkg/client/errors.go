@@ -0,0 +1,78 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Errors returned by Client methods can be compared to these with errors.Is
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrBlocked         = errors.New("destination is blocked")
+	ErrLinkExists      = errors.New("link exists already")
+	ErrLinkElsewhere   = errors.New("link exists already and redirects elsewhere")
+	ErrNotFound        = errors.New("not found")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrServer          = errors.New("server error")
+
+	// ErrChallengeFailed means the challenge answer was wrong or the submission looked like a bot
+	ErrChallengeFailed = errors.New("anti-bot challenge failed")
+
+	// ErrUnsolvable is returned by solvers for challenges they cannot answer
+	ErrUnsolvable = errors.New("challenge cannot be solved automatically")
+)
+
+// ErrorResponse codes of the server, which tell errors with the same status code apart
+const (
+	codeChallengeFailed = "challenge_failed"
+	codeBlocked         = "destination_blocked"
+	codeLinkExists      = "link_exists"
+	codeLinkElsewhere   = "link_elsewhere"
+)
+
+// Error is an error response of the server
+type Error struct {
+	StatusCode int
+
+	// Message is the error of the ErrorResponse, or the status text when the body has none
+	Message string
+
+	// Code is the code of the ErrorResponse, which is empty for most errors
+	Code string
+
+	// RetryAfter is set for ErrTooManyRequests when the server says when to retry
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("heyluuk: %d: %s", e.StatusCode, e.Message)
+}
+
+// Is maps the status code and error code to the Err* values of this package
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrChallengeFailed:
+		return e.Code == codeChallengeFailed
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrBlocked:
+		// creating links to blocked destinations is a bad request, resolving them is forbidden
+		return e.Code == codeBlocked || e.StatusCode == http.StatusForbidden
+	case ErrLinkExists:
+		return e.Code == codeLinkExists
+	case ErrLinkElsewhere:
+		return e.Code == codeLinkElsewhere
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrTooManyRequests:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
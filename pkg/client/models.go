@@ -0,0 +1,79 @@
+package client
+
+import "time"
+
+// Challenge kinds, see Challenge.Kind
+const (
+	KindArithmetic  = "arithmetic"
+	KindProofOfWork = "proof-of-work"
+)
+
+// Node is one path segment of a shortcut
+type Node struct {
+	ID uint `json:"id"`
+
+	// Parent is the ID of the parent node, nil for root nodes
+	Parent      *uint  `json:"parent"`
+	PathSegment string `json:"path_segment"`
+
+	// URL is empty when the node is only part of longer shortcuts
+	URL string `json:"url"`
+}
+
+// Revision is one change to a shortcut
+type Revision struct {
+	ID        uint      `json:"id"`
+	Node      uint      `json:"node"`
+	Path      string    `json:"path"`
+	Action    string    `json:"action"`
+	OldURL    string    `json:"old_url"`
+	NewURL    string    `json:"new_url"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Challenge has to be answered to create links without an API key
+type Challenge struct {
+	ID string `json:"id"`
+
+	// Question is shown to the user, or the nonce for proofs of work
+	Question string `json:"question"`
+	Kind     string `json:"kind"`
+	Language string `json:"language,omitempty"`
+
+	// Difficulty is the number of leading zero bits of SHA-256(question + ":" + answer) for proofs of work
+	Difficulty int   `json:"difficulty,omitempty"`
+	ExpiresAt  int64 `json:"expires_at,omitempty"`
+}
+
+// Link is a created or restored shortcut
+type Link struct {
+	Shortcut string `json:"shortcut"`
+	Redirect string `json:"redirect"`
+
+	// Existing lists other shortcuts that already redirect to the same URL
+	Existing []string `json:"existing,omitempty"`
+}
+
+// LinksByURL lists the shortcuts redirecting to URL
+type LinksByURL struct {
+	URL       string   `json:"url"`
+	Shortcuts []string `json:"shortcuts"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+type postLinkBody struct {
+	URL             string `json:"url"`
+	Path            string `json:"path"`
+	ChallengeID     string `json:"challenge-id,omitempty"`
+	ChallengeAnswer string `json:"challenge-answer,omitempty"`
+}
+
+type rollbackLinkBody struct {
+	Path     string `json:"path"`
+	Revision uint   `json:"revision"`
+}
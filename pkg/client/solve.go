@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// Solver answers a challenge, for instance by asking a user
+type Solver func(ctx context.Context, challenge Challenge) (string, error)
+
+// SolveArithmetic answers arithmetic questions like "7x3=", other questions are ErrUnsolvable
+func SolveArithmetic(ctx context.Context, challenge Challenge) (string, error) {
+
+	if challenge.Kind != KindArithmetic {
+		return "", ErrUnsolvable
+	}
+
+	var a, b int
+	var operator rune
+	if _, err := fmt.Sscanf(challenge.Question, "%d%c%d=", &a, &operator, &b); err != nil {
+		return "", ErrUnsolvable
+	}
+
+	switch operator {
+	case '+':
+		return strconv.Itoa(a + b), nil
+	case '-':
+		return strconv.Itoa(a - b), nil
+	case 'x':
+		return strconv.Itoa(a * b), nil
+	case '/':
+		if b != 0 {
+			return strconv.Itoa(a / b), nil
+		}
+	}
+
+	return "", ErrUnsolvable
+}
+
+// SolveProofOfWork finds an answer such that SHA-256(question + ":" + answer) starts with
+// enough zero bits, it stops when ctx is done
+func SolveProofOfWork(ctx context.Context, challenge Challenge) (string, error) {
+
+	if challenge.Kind != KindProofOfWork {
+		return "", ErrUnsolvable
+	}
+
+	for answer := 0; ; answer++ {
+
+		if answer%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+		}
+
+		candidate := strconv.Itoa(answer)
+		if leadingZeroBits(sha256.Sum256([]byte(challenge.Question+":"+candidate))) >= challenge.Difficulty {
+			return candidate, nil
+		}
+	}
+}
+
+// SolveAutomatically tries to solve a challenge without a user, which fails for questions from question banks
+func SolveAutomatically(ctx context.Context, challenge Challenge) (string, error) {
+	if challenge.Kind == KindProofOfWork {
+		return SolveProofOfWork(ctx, challenge)
+	}
+	return SolveArithmetic(ctx, challenge)
+}
+
+func leadingZeroBits(hash [sha256.Size]byte) int {
+	count := 0
+	for _, b := range hash {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
@@ -0,0 +1,23 @@
+#!/bin/bash
+
+# Copies the frontend dependencies installed by npm into the static files, so they are embedded in the binary.
+# Dependencies are installed from npm/package-lock.json first when NODE_MODULES_DIR does not exist.
+# Usage: vendor-frontend.sh NODE_MODULES_DIR STATIC_VENDOR_DIR
+# It runs with `go generate ./web`, building fails as long as the dependencies are missing.
+
+set -euo pipefail
+
+node_modules=${1:-npm/node_modules}
+vendor=${2:-web/static/vendor}
+
+if [ ! -d "$node_modules" ]; then
+    npm ci --prefix "$(dirname "$node_modules")"
+fi
+
+rm -rf "$vendor"
+mkdir -p "$vendor/font-awesome"
+
+cp -r "$node_modules/jquery/dist" "$vendor/jquery"
+cp -r "$node_modules/bootstrap/dist" "$vendor/bootstrap"
+cp -r "$node_modules/patternfly-bootstrap-treeview/dist" "$vendor/patternfly-bootstrap-treeview"
+cp -r "$node_modules/@fortawesome/fontawesome-free/css" "$node_modules/@fortawesome/fontawesome-free/webfonts" "$vendor/font-awesome"
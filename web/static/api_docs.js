@@ -0,0 +1,158 @@
+var METHOD_CLASSES = {
+    get: "badge-primary",
+    post: "badge-success",
+    put: "badge-warning",
+    delete: "badge-danger"
+};
+
+// resolve a "#/components/schemas/Name" reference
+function resolve_schema(spec, schema) {
+    if (schema && schema["$ref"]) {
+        var name = schema["$ref"].split("/").pop();
+        return spec.components.schemas[name];
+    }
+    return schema;
+}
+
+// build an example request body from the properties of a schema
+function example_body(spec, schema) {
+    schema = resolve_schema(spec, schema);
+    var body = {};
+    $.each(schema.properties || {}, function (name, property) {
+        if (property.example !== undefined) {
+            body[name] = property.example;
+        } else if (property.type === "integer") {
+            body[name] = 0;
+        } else {
+            body[name] = "";
+        }
+    });
+    return JSON.stringify(body, null, 2);
+}
+
+function render_operation(spec, path, method, operation, index) {
+    var id = "operation-" + index;
+    var card = $("<div class='card mb-2'></div>");
+
+    var header = $("<div class='card-header'></div>").attr("data-toggle", "collapse").attr("data-target", "#" + id);
+    header.append($("<span class='badge mr-2'></span>").addClass(METHOD_CLASSES[method]).text(method.toUpperCase()));
+    header.append($("<code class='mr-2'></code>").text(path));
+    header.append($("<span></span>").text(operation.summary || ""));
+    card.append(header);
+
+    var body = $("<div class='card-body collapse'></div>").attr("id", id);
+    if (operation.description) {
+        body.append($("<p></p>").text(operation.description));
+    }
+
+    var form = $("<form></form>");
+
+    $.each(operation.parameters || [], function (_index, parameter) {
+        var group = $("<div class='form-group'></div>");
+        group.append($("<label></label>").text(parameter.name + " (" + parameter.in + ")"));
+        group.append($("<input type='text' class='form-control'>")
+            .attr("name", parameter.name)
+            .attr("data-in", parameter.in)
+            .attr("placeholder", parameter.description || ""));
+        form.append(group);
+    });
+
+    if (operation.security) {
+        var group = $("<div class='form-group'></div>");
+        group.append($("<label>Bearer token</label>"));
+        group.append($("<input type='password' class='form-control' data-in='token'>"));
+        form.append(group);
+    }
+
+    if (operation.requestBody) {
+        var schema = operation.requestBody.content["application/json"].schema;
+        var group = $("<div class='form-group'></div>");
+        group.append($("<label>Request body</label>"));
+        group.append($("<textarea class='form-control text-monospace' rows='8' data-in='body'></textarea>")
+            .val(example_body(spec, schema)));
+        form.append(group);
+    }
+
+    var responses = $("<ul></ul>");
+    $.each(operation.responses, function (status, response) {
+        responses.append($("<li></li>").text(status + ": " + response.description));
+    });
+
+    form.append($("<button class='btn btn-primary mb-2'>Try it</button>"));
+    body.append(form);
+    body.append($("<h5>Responses</h5>"));
+    body.append(responses);
+
+    var result = $("<pre class='bg-light p-2' style='display:none;'></pre>");
+    body.append(result);
+    card.append(body);
+
+    form.submit(function () {
+        var url = path;
+        var query = {};
+        var headers = {};
+        var data;
+
+        form.find("[data-in]").each(function (_index, input) {
+            var value = $(input).val();
+            switch ($(input).attr("data-in")) {
+                case "path":
+                    url = url.replace("{" + $(input).attr("name") + "}", encodeURIComponent(value));
+                    break;
+                case "query":
+                    query[$(input).attr("name")] = value;
+                    break;
+                case "token":
+                    headers["Authorization"] = "Bearer " + value;
+                    break;
+                case "body":
+                    data = value;
+                    break;
+            }
+        });
+
+        if (!$.isEmptyObject(query)) {
+            url += "?" + $.param(query);
+        }
+
+        $.ajax({
+            type: method.toUpperCase(),
+            url: url,
+            headers: headers,
+            contentType: "application/json; charset=utf-8",
+            data: data,
+            dataType: "text",
+            complete: function (xhr) {
+                var text = xhr.responseText;
+                try {
+                    text = JSON.stringify(JSON.parse(text), null, 2);
+                } catch (_e) {
+                }
+                result.text(xhr.status + " " + xhr.statusText + "\n\n" + text).show();
+            }
+        });
+
+        return false;
+    });
+
+    return card;
+}
+
+function load_api_docs() {
+    $.ajax({
+        url: "/api/openapi.json",
+        success: function (spec) {
+            var index = 0;
+            var container = $("#api-operations");
+            $.each(spec.paths, function (path, operations) {
+                $.each(operations, function (method, operation) {
+                    container.append(render_operation(spec, path, method, operation, index++));
+                });
+            });
+        }
+    });
+}
+
+$(document).ready(function () {
+    load_api_docs();
+});
@@ -1,11 +1,45 @@
 
+function leading_zero_bits(bytes) {
+    var count = 0;
+    for (var i = 0; i < bytes.length; i++) {
+        if (bytes[i] !== 0) {
+            return count + Math.clz32(bytes[i]) - 24;
+        }
+        count += 8;
+    }
+    return count;
+}
+
+// find an answer such that SHA-256(nonce + ":" + answer) starts with enough zero bits
+async function solve_proof_of_work(nonce, difficulty) {
+    var encoder = new TextEncoder();
+    for (var answer = 0; ; answer++) {
+        var hash = await crypto.subtle.digest("SHA-256", encoder.encode(nonce + ":" + answer));
+        if (leading_zero_bits(new Uint8Array(hash)) >= difficulty) {
+            return answer.toString();
+        }
+    }
+}
+
 function load_new_challenge() {
     $.ajax({
         type: "GET",
         url: '/api/challenge',
         success: function (result) {
-            $("#form-challenge-question").html(result.question);
             $("#form-challenge-id").attr("value", result.id);
+
+            if (result.kind !== "proof-of-work") {
+                $("#form-challenge-question").text(result.question).attr("lang", result.language || null);
+                return;
+            }
+
+            $("#form-challenge").hide();
+            $("#submit").prop("disabled", true).text("Checking you are not a bot...");
+
+            solve_proof_of_work(result.question, result.difficulty).then(function (answer) {
+                $("#form-challenge-answer").val(answer);
+                $("#submit").prop("disabled", false).text("Create link");
+            });
         }
     });
 }
@@ -21,10 +55,12 @@ function nodes_api_to_array(data, link_prefix) {
     var children = [];
     $(data).each(function(_index, element){
 
-        var text = element.path_segment;
+        // the tree renders text as HTML, so it is escaped by serializing an element
+        var text = $("<span>").text(element.path_segment).html();
 
         if(element['url'] !== '') {
-            text = '<a href="' + link_prefix + '/' + element.path_segment + '" target="_blank">' + text + '</a>';
+            text = $("<a>").attr("href", link_prefix + '/' + element.path_segment).attr("target", "_blank")
+                .text(element.path_segment).prop("outerHTML");
         }
 
         children.push({
@@ -77,6 +113,16 @@ function load_link_tree() {
     });
 }
 
+// text_node returns text which is never parsed as HTML
+function text_node(text) {
+    return document.createTextNode(text);
+}
+
+// shortcut_link returns a link to a shortcut, the shortcut is never parsed as HTML
+function shortcut_link(shortcut) {
+    return $("<a>").attr("target", "_blank").attr("href", shortcut).text(window.location.host + shortcut);
+}
+
 $(document).ready(function () {
 
     load_new_challenge();
@@ -96,15 +142,26 @@ $(document).ready(function () {
             url: '/api/link',
             data: JSON.stringify(body),
             success: function (result) {
-                var message = "Your link <a target='_blank' href='" + result['shortcut'] + "'>" + window.location.host + result['shortcut'] + "</a> has been created.";
-                $("#form-alert").html(message).removeClass("alert-danger").addClass("alert-success").show();
+                var alert = $("#form-alert").empty();
+                alert.append(text_node("Your link "), shortcut_link(result['shortcut']), text_node(" has been created."));
+                if (result['existing']) {
+                    alert.append(text_node(" This URL was already available as "));
+                    result['existing'].forEach(function (shortcut, index) {
+                        if (index > 0) {
+                            alert.append(text_node(", "));
+                        }
+                        alert.append(shortcut_link(shortcut));
+                    });
+                    alert.append(text_node("."));
+                }
+                alert.removeClass("alert-danger").addClass("alert-success").show();
                 $("#new-link-form").find("input").val("");
                 load_new_challenge();
                 load_link_tree();
             },
             error: function (xhr, _resp, _text) {
                 var message = "Error: " + xhr.responseJSON["error"];
-                $("#form-alert").html(message).removeClass("alert-success").addClass("alert-danger").show();
+                $("#form-alert").text(message).removeClass("alert-success").addClass("alert-danger").show();
                 $("#form-challenge-answer").val("");
                 load_new_challenge();
             }
@@ -0,0 +1,91 @@
+function format_number(value, digits) {
+    if (value === null || value === undefined) {
+        return "-";
+    }
+    return value.toFixed(digits);
+}
+
+function format_percentage(value) {
+    if (value === null || value === undefined) {
+        return "-";
+    }
+    return (value * 100).toFixed(0) + "%";
+}
+
+function stats_table(first_column, rows) {
+    var table = $("<table class='table table-sm'></table>");
+    var header = $("<tr></tr>");
+    $([first_column, "Resolved", "Ambiguous", "Hit rate", "Scored", "Brier score"]).each(function (_index, name) {
+        header.append($("<th></th>").text(name));
+    });
+    table.append($("<thead></thead>").append(header));
+
+    var body = $("<tbody></tbody>");
+    $(rows).each(function (_index, row) {
+        var stats = row.stats;
+        var tr = $("<tr></tr>");
+        $([row.name, stats.resolved, stats.ambiguous, format_percentage(stats.hit_rate), stats.scored,
+            format_number(stats.brier_score, 3)]).each(function (_index, value) {
+            tr.append($("<td></td>").text(value));
+        });
+        body.append(tr);
+    });
+    table.append(body);
+
+    return table;
+}
+
+function calibration_table(buckets) {
+    if (buckets.length === 0) {
+        return $("<p></p>").text("No resolved predictions with a stated probability yet.");
+    }
+
+    var table = $("<table class='table table-sm'></table>");
+    table.append("<thead><tr><th>Stated probability</th><th>Predictions</th><th>Mean stated</th><th>Came true</th></tr></thead>");
+
+    var body = $("<tbody></tbody>");
+    $(buckets).each(function (_index, bucket) {
+        var tr = $("<tr></tr>");
+        $([format_percentage(bucket.lower) + " - " + format_percentage(bucket.upper), bucket.count,
+            format_percentage(bucket.mean_probability), format_percentage(bucket.observed_frequency)]).each(function (_index, value) {
+            tr.append($("<td></td>").text(value));
+        });
+        body.append(tr);
+    });
+    table.append(body);
+
+    return table;
+}
+
+function load_stats(period) {
+    $.ajax({
+        url: "/api/prediction/stats",
+        data: {period: period},
+        success: function (result) {
+            $("#stats-alert").hide();
+            $("#stats-overall").empty().append(stats_table("", [{name: "All", stats: result.overall}]));
+            $("#stats-calibration").empty().append(calibration_table(result.overall.buckets));
+
+            var categories = Object.keys(result.categories).sort().map(function (name) {
+                return {name: name, stats: result.categories[name]};
+            });
+            $("#stats-categories").empty().append(stats_table("Category", categories));
+
+            var periods = result.periods.map(function (stats) {
+                return {name: stats.period, stats: stats};
+            });
+            $("#stats-periods").empty().append(stats_table("Period", periods));
+        },
+        error: function (xhr) {
+            $("#stats-alert").text("Loading stats failed: " + xhr.statusText).show();
+        }
+    });
+}
+
+$(document).ready(function () {
+    load_stats($("#stats-period").val());
+
+    $("#stats-period").change(function () {
+        load_stats($(this).val());
+    });
+});
@@ -0,0 +1,67 @@
+function form_body(form) {
+    var body = {};
+    $(form.serializeArray()).each(function (_index, obj) {
+        body[obj.name] = obj.value;
+    });
+    return JSON.stringify(body);
+}
+
+function show_alert(alert, success, message) {
+    alert.text(message)
+        .removeClass(success ? "alert-danger" : "alert-success")
+        .addClass(success ? "alert-success" : "alert-danger")
+        .show();
+}
+
+function error_message(xhr) {
+    if (xhr.responseJSON && xhr.responseJSON["error"]) {
+        return "Error: " + xhr.responseJSON["error"];
+    }
+    return "Error: " + xhr.statusText;
+}
+
+$(document).ready(function () {
+
+    $("#verify-form").submit(function () {
+        $.ajax({
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            url: "/api/prediction/verify",
+            data: form_body($("#verify-form")),
+            success: function (result) {
+                var prediction = result["prediction"];
+                if (!prediction) {
+                    show_alert($("#verify-alert"), false, "No prediction has commitment " + result["commitment"] + ".");
+                    return;
+                }
+                show_alert($("#verify-alert"), true, "This matches prediction #" + prediction["id"] +
+                    ", which was made at " + prediction["created_at"] + ".");
+            },
+            error: function (xhr) {
+                show_alert($("#verify-alert"), false, error_message(xhr));
+            }
+        });
+
+        return false;
+    });
+
+    $(".reveal-form").submit(function () {
+        var form = $(this);
+        var alert = form.find(".alert");
+
+        $.ajax({
+            type: "POST",
+            contentType: "application/json; charset=utf-8",
+            url: "/api/prediction/" + form.attr("data-id") + "/reveal",
+            data: form_body(form),
+            success: function () {
+                window.location.reload();
+            },
+            error: function (xhr) {
+                show_alert(alert, false, error_message(xhr));
+            }
+        });
+
+        return false;
+    });
+});
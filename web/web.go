@@ -0,0 +1,30 @@
+// Package web holds the templates and static files of the site, they are embedded in the binary
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+//go:generate bash ../scripts/vendor-frontend.sh ../npm/node_modules static/vendor
+
+// files also lists the frontend dependencies used by the templates, so building fails
+// when they were not copied into static/vendor by go generate
+//
+//go:embed templates static
+//go:embed static/vendor/jquery/jquery.min.js
+//go:embed static/vendor/bootstrap/css/bootstrap.min.css static/vendor/bootstrap/js/bootstrap.min.js
+//go:embed static/vendor/patternfly-bootstrap-treeview/bootstrap-treeview.min.css
+//go:embed static/vendor/patternfly-bootstrap-treeview/bootstrap-treeview.min.js
+//go:embed static/vendor/font-awesome/css/all.min.css static/vendor/font-awesome/webfonts
+var files embed.FS
+
+// FS returns the embedded files, or the files in dir when it is not empty so they can be
+// edited without rebuilding. Both have a templates and a static directory.
+func FS(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return files
+}